@@ -0,0 +1,22 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+/*
+`http_adaptive` is a HTTP client-side Tripperware that adapts the allowed concurrency of each service to its health.
+
+A fixed concurrency limit, like the one of `http_bulkhead`, is hard to tune: too low and it throttles a healthy service,
+too high and it doesn't protect from a struggling one. The `Limiter` instead keeps a limit for each service (identified
+by the `http.call.service` tag set by `http_ctxtags.Tripperware`) that is adjusted from the latency and the failures of
+the requests. Requests over the current limit are rejected with a `*LimitedError`.
+
+Algorithms
+
+The algorithm adjusting the limit is pluggable, see the `Limit` interface. The ones provided are:
+
+	AIMDLimit     - additive increase, multiplicative decrease on failures or timeouts, like TCP congestion control.
+	GradientLimit - scales the limit by the ratio of the minimum latency to the current one.
+	VegasLimit    - estimates the queue at the service from the latency, like TCP Vegas.
+
+Each service gets its own instance of the algorithm, created with the function passed to `WithLimit`.
+*/
+package http_adaptive
@@ -0,0 +1,156 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_adaptive
+
+import (
+	"math"
+	"time"
+)
+
+// Sample is the outcome of a single request, used to adjust the limit.
+type Sample struct {
+	// RTT is the time it took to get the response.
+	RTT time.Duration
+	// InFlight is the number of requests in flight when the request was made, including itself.
+	InFlight int
+	// Dropped is true if the request failed, or the response shows that the service is overloaded.
+	Dropped bool
+	// Time is the time the response was received at.
+	Time time.Time
+}
+
+// Limit is an algorithm for adjusting the allowed concurrency of a service.
+//
+// The calls of a single instance are synchronized by the Limiter, so implementations don't need to be thread-safe.
+type Limit interface {
+	// Limit returns the current number of requests allowed in flight.
+	Limit() int
+	// Update adjusts the limit with the outcome of a request.
+	Update(sample Sample)
+}
+
+// AIMDLimit increases the limit by one for every successful request, and decreases it by a ratio on failures.
+//
+// Requests that took longer than the timeout count as failures. The limit is only increased when at least half of it
+// was in use, so that it doesn't grow unbounded for services with little traffic.
+type AIMDLimit struct {
+	limit        float64
+	min          float64
+	max          float64
+	backoffRatio float64
+	timeout      time.Duration
+}
+
+// NewAIMDLimit creates a new AIMD limit, between min and max.
+func NewAIMDLimit(initial int, min int, max int, backoffRatio float64, timeout time.Duration) *AIMDLimit {
+	return &AIMDLimit{limit: float64(initial), min: float64(min), max: float64(max), backoffRatio: backoffRatio, timeout: timeout}
+}
+
+func (l *AIMDLimit) Limit() int {
+	return int(l.limit)
+}
+
+func (l *AIMDLimit) Update(s Sample) {
+	if s.Dropped || (l.timeout > 0 && s.RTT > l.timeout) {
+		l.limit = clamp(l.limit*l.backoffRatio, l.min, l.max)
+	} else if isUtilized(s, l.limit) {
+		l.limit = clamp(l.limit+1, l.min, l.max)
+	}
+}
+
+// GradientLimit scales the limit by the gradient of the minimum latency to the current one.
+//
+// When the latency rises above the minimum, the service is queueing requests and the limit shrinks. When it stays at the
+// minimum, the limit grows by its square root, which works as the allowed queue. The minimum latency is measured anew
+// every minRTTWindow, in case the service got permanently slower.
+type GradientLimit struct {
+	limit        float64
+	min          float64
+	max          float64
+	minRTT       time.Duration
+	minRTTWindow time.Duration
+	minRTTSince  time.Time
+}
+
+// gradientSmoothing is the weight of a new limit in the GradientLimit, so that it doesn't fluctuate with every request.
+const gradientSmoothing = 0.2
+
+// NewGradientLimit creates a new gradient limit, between min and max.
+func NewGradientLimit(initial int, min int, max int, minRTTWindow time.Duration) *GradientLimit {
+	return &GradientLimit{limit: float64(initial), min: float64(min), max: float64(max), minRTTWindow: minRTTWindow}
+}
+
+func (l *GradientLimit) Limit() int {
+	return int(l.limit)
+}
+
+func (l *GradientLimit) Update(s Sample) {
+	if l.minRTT == 0 || s.RTT < l.minRTT || s.Time.Sub(l.minRTTSince) >= l.minRTTWindow {
+		l.minRTT = s.RTT
+		l.minRTTSince = s.Time
+	}
+	gradient := 0.5
+	if !s.Dropped {
+		if !isUtilized(s, l.limit) {
+			return
+		}
+		gradient = clamp(float64(l.minRTT)/float64(s.RTT), 0.5, 1.0)
+	}
+	newLimit := l.limit*gradient + math.Sqrt(l.limit)
+	smoothed := l.limit*(1-gradientSmoothing) + newLimit*gradientSmoothing
+	if s.Dropped || newLimit < l.limit {
+		// Shrink by at least one, otherwise small limits would stay the same, or even grow by the square root.
+		smoothed = math.Min(smoothed, l.limit-1)
+	}
+	l.limit = clamp(smoothed, l.min, l.max)
+}
+
+// VegasLimit estimates the number of requests queued at the service from the latency, keeping it within bounds.
+//
+// The queue is estimated as `limit * (1 - minRTT/RTT)`. The limit grows while the queue is smaller than
+// 3*log10(limit), shrinks when it is larger than 6*log10(limit), and halves on failures.
+type VegasLimit struct {
+	limit  float64
+	min    float64
+	max    float64
+	minRTT time.Duration
+}
+
+// NewVegasLimit creates a new Vegas limit, between min and max.
+func NewVegasLimit(initial int, min int, max int) *VegasLimit {
+	return &VegasLimit{limit: float64(initial), min: float64(min), max: float64(max)}
+}
+
+func (l *VegasLimit) Limit() int {
+	return int(l.limit)
+}
+
+func (l *VegasLimit) Update(s Sample) {
+	if l.minRTT == 0 || s.RTT < l.minRTT {
+		l.minRTT = s.RTT
+	}
+	if s.Dropped {
+		l.limit = clamp(l.limit/2, l.min, l.max)
+		return
+	}
+	if !isUtilized(s, l.limit) {
+		return
+	}
+	queue := l.limit * (1 - float64(l.minRTT)/float64(s.RTT))
+	threshold := math.Max(1, math.Log10(l.limit))
+	if queue <= 3*threshold {
+		l.limit = clamp(l.limit+1, l.min, l.max)
+	} else if queue >= 6*threshold {
+		l.limit = clamp(l.limit-1, l.min, l.max)
+	}
+}
+
+// isUtilized checks whether at least half of the limit was in use, otherwise the sample tells little about the limit.
+func isUtilized(s Sample, limit float64) bool {
+	return float64(s.InFlight)*2 >= limit
+}
+
+func clamp(value float64, min float64, max float64) float64 {
+	return math.Max(min, math.Min(max, value))
+}
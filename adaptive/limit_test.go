@@ -0,0 +1,72 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_adaptive_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-httpwares/adaptive"
+	"github.com/mwitkow/go-httpwares/testing"
+	"github.com/stretchr/testify/assert"
+)
+
+// drive updates the limit with samples of the given latency at full utilization, advancing the clock.
+func drive(limit http_adaptive.Limit, clock *httpwares_testing.FakeClock, count int, rtt time.Duration, dropped bool) {
+	for i := 0; i < count; i++ {
+		clock.Advance(rtt)
+		limit.Update(http_adaptive.Sample{RTT: rtt, InFlight: limit.Limit(), Dropped: dropped, Time: clock.Now()})
+	}
+}
+
+func TestAIMDLimit(t *testing.T) {
+	clock := httpwares_testing.NewFakeClock(time.Unix(1000, 0))
+	limit := http_adaptive.NewAIMDLimit(10, 1, 15, 0.5, 100*time.Millisecond)
+	drive(limit, clock, 3, 10*time.Millisecond, false)
+	assert.Equal(t, 13, limit.Limit(), "the limit must increase by one for each success")
+	drive(limit, clock, 5, 10*time.Millisecond, false)
+	assert.Equal(t, 15, limit.Limit(), "the limit must not increase over the max")
+	drive(limit, clock, 1, 10*time.Millisecond, true)
+	assert.Equal(t, 7, limit.Limit(), "the limit must back off on failures")
+	drive(limit, clock, 1, 200*time.Millisecond, false)
+	assert.Equal(t, 3, limit.Limit(), "the limit must back off on timeouts")
+
+	limit.Update(http_adaptive.Sample{RTT: 10 * time.Millisecond, InFlight: 1, Time: clock.Now()})
+	assert.Equal(t, 3, limit.Limit(), "the limit must not increase when it is not used")
+}
+
+func TestGradientLimit(t *testing.T) {
+	clock := httpwares_testing.NewFakeClock(time.Unix(1000, 0))
+	limit := http_adaptive.NewGradientLimit(20, 1, 200, time.Hour)
+	drive(limit, clock, 20, 10*time.Millisecond, false)
+	grown := limit.Limit()
+	assert.True(t, grown > 20, "the limit must grow while the latency is at the minimum, got %d", grown)
+	drive(limit, clock, 20, 40*time.Millisecond, false)
+	assert.True(t, limit.Limit() < grown, "the limit must shrink when the latency rises, got %d", limit.Limit())
+
+	small := http_adaptive.NewGradientLimit(4, 1, 200, time.Hour)
+	drive(small, clock, 1, 10*time.Millisecond, true)
+	assert.Equal(t, 3, small.Limit(), "small limits must shrink by at least one")
+	drive(small, clock, 5, 10*time.Millisecond, true)
+	assert.Equal(t, 1, small.Limit(), "the limit must not shrink below the min")
+}
+
+func TestGradientLimitRemeasuresMinRTT(t *testing.T) {
+	clock := httpwares_testing.NewFakeClock(time.Unix(1000, 0))
+	limit := http_adaptive.NewGradientLimit(20, 1, 200, time.Second)
+	drive(limit, clock, 1, 10*time.Millisecond, false)
+	drive(limit, clock, 100, 40*time.Millisecond, false)
+	assert.True(t, limit.Limit() > 20, "a permanently slower service must have its minimum latency measured anew, got %d", limit.Limit())
+}
+
+func TestVegasLimit(t *testing.T) {
+	clock := httpwares_testing.NewFakeClock(time.Unix(1000, 0))
+	limit := http_adaptive.NewVegasLimit(20, 1, 200)
+	drive(limit, clock, 10, 10*time.Millisecond, false)
+	assert.Equal(t, 30, limit.Limit(), "the limit must grow while there's no queue")
+	drive(limit, clock, 5, 20*time.Millisecond, false)
+	assert.Equal(t, 25, limit.Limit(), "the limit must shrink when the queue is long")
+	drive(limit, clock, 1, 10*time.Millisecond, true)
+	assert.Equal(t, 12, limit.Limit(), "the limit must halve on failures")
+}
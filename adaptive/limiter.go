@@ -0,0 +1,90 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_adaptive
+
+import (
+	"sync"
+)
+
+// Limiter keeps the adaptive concurrency limits of services.
+//
+// A single Limiter is meant to be shared between Tripperwares, and is safe for concurrent use.
+type Limiter struct {
+	opts *options
+
+	mu       sync.Mutex
+	services map[string]*serviceLimit
+}
+
+// Stats is a snapshot of the state of the limit of a single service, meant for metrics.
+type Stats struct {
+	// Limit is the current number of requests allowed in flight.
+	Limit int
+	// InFlight is the number of requests in flight.
+	InFlight int
+	// Rejected is the total number of requests rejected over the limit.
+	Rejected uint64
+}
+
+type serviceLimit struct {
+	mu    sync.Mutex
+	limit Limit
+	stats Stats
+}
+
+// NewLimiter creates a new Limiter.
+func NewLimiter(opts ...Option) *Limiter {
+	return &Limiter{opts: evaluateOptions(opts), services: make(map[string]*serviceLimit)}
+}
+
+// Stats returns a snapshot of the limits of each of the services seen so far.
+func (l *Limiter) Stats() map[string]Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ret := make(map[string]Stats, len(l.services))
+	for service, s := range l.services {
+		s.mu.Lock()
+		ret[service] = s.stats
+		s.mu.Unlock()
+	}
+	return ret
+}
+
+func (l *Limiter) service(service string) *serviceLimit {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s, ok := l.services[service]
+	if !ok {
+		s = &serviceLimit{limit: l.opts.newLimit()}
+		s.stats.Limit = s.limit.Limit()
+		l.services[service] = s
+	}
+	return s
+}
+
+// acquire takes a slot if the limit allows, returning the number of requests in flight and the limit.
+func (s *serviceLimit) acquire() (inFlight int, limit int, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	limit = s.limit.Limit()
+	if s.stats.InFlight >= limit {
+		s.stats.Rejected++
+		return s.stats.InFlight, limit, false
+	}
+	s.stats.InFlight++
+	return s.stats.InFlight, limit, true
+}
+
+func (s *serviceLimit) update(sample Sample) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limit.Update(sample)
+	s.stats.Limit = s.limit.Limit()
+}
+
+func (s *serviceLimit) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.InFlight--
+}
@@ -0,0 +1,69 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_adaptive
+
+import (
+	"net/http"
+	"time"
+)
+
+var (
+	defaultOptions = &options{
+		newLimit: func() Limit {
+			return NewAIMDLimit(20, 1, 1000, 0.9, 5*time.Second)
+		},
+		failureFunc: DefaultResponseFailure,
+		clock:       time.Now,
+	}
+)
+
+type options struct {
+	newLimit    func() Limit
+	failureFunc ResponseFailureFunc
+	clock       func() time.Time
+}
+
+func evaluateOptions(opts []Option) *options {
+	optCopy := &options{}
+	*optCopy = *defaultOptions
+	for _, o := range opts {
+		o(optCopy)
+	}
+	return optCopy
+}
+
+type Option func(*options)
+
+// ResponseFailureFunc decides whether the response shows that the service is failing or overloaded (on true).
+type ResponseFailureFunc func(resp *http.Response) bool
+
+// WithLimit sets the function creating the Limit algorithm for each service.
+//
+// By default it is an `AIMDLimit` starting at 20, between 1 and 1000, backing off by 0.9 and with a 5 second timeout.
+func WithLimit(newLimit func() Limit) Option {
+	return func(o *options) {
+		o.newLimit = newLimit
+	}
+}
+
+// WithResponseFailure is a function option that decides which responses count as dropped requests.
+//
+// Errors returned by the next RoundTripper always count as dropped, unless the request was cancelled by the caller.
+func WithResponseFailure(f ResponseFailureFunc) Option {
+	return func(o *options) {
+		o.failureFunc = f
+	}
+}
+
+// WithClock sets the source of time used for measuring latency, meant for tests.
+func WithClock(now func() time.Time) Option {
+	return func(o *options) {
+		o.clock = now
+	}
+}
+
+// DefaultResponseFailure is the default implementation of the failure classifier, treating 429 and 5xx as failures.
+func DefaultResponseFailure(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
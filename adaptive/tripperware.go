@@ -0,0 +1,68 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_adaptive
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/internal"
+	"github.com/mwitkow/go-httpwares/tags"
+)
+
+// LimitedError is returned by the Tripperware for requests over the current limit of a service.
+type LimitedError struct {
+	// Service is the name of the service (or the host) the limit is kept for.
+	Service string
+	// Limit is the limit at the time the request was rejected.
+	Limit int
+}
+
+func (e *LimitedError) Error() string {
+	return fmt.Sprintf("http_adaptive: concurrency limit of %d for %v reached", e.Limit, e.Service)
+}
+
+// IsLimitedError checks whether the error, possibly returned from `http.Client`, is caused by the limit.
+func IsLimitedError(err error) bool {
+	_, ok := http_internal.UnwrapURLError(err).(*LimitedError)
+	return ok
+}
+
+// Tripperware is client side HTTP ware that limits the concurrent requests to each service adaptively.
+//
+// A request stays in flight until its response body is closed, while its latency is measured until the response is
+// returned. It needs to be placed after `http_ctxtags.Tripperware` in the chain for the limits to be kept by service
+// name.
+func Tripperware(l *Limiter) httpwares.Tripperware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return httpwares.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			service := http_ctxtags.ServiceName(req)
+			s := l.service(service)
+			inFlight, limit, ok := s.acquire()
+			if !ok {
+				return nil, &LimitedError{Service: service, Limit: limit}
+			}
+			startTime := l.opts.clock()
+			resp, err := next.RoundTrip(req)
+			if err != context.Canceled && req.Context().Err() != context.Canceled {
+				// Requests cancelled by the caller say nothing about the service.
+				now := l.opts.clock()
+				s.update(Sample{
+					RTT:      now.Sub(startTime),
+					InFlight: inFlight,
+					Dropped:  err != nil || l.opts.failureFunc(resp),
+					Time:     now,
+				})
+			}
+			if resp == nil || resp.Body == nil {
+				s.release()
+				return resp, err
+			}
+			resp.Body = http_internal.ReleaseOnCloseBody(resp.Body, s.release)
+			return resp, err
+		})
+	}
+}
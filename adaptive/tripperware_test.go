@@ -0,0 +1,89 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_adaptive_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/adaptive"
+	"github.com/mwitkow/go-httpwares/tags"
+	"github.com/mwitkow/go-httpwares/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func adaptiveClient(limiter *http_adaptive.Limiter, clock *httpwares_testing.FakeClock, latency time.Duration, code int) *http.Client {
+	transport := httpwares.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		clock.Advance(latency)
+		return &http.Response{StatusCode: code, Body: ioutil.NopCloser(strings.NewReader("")), Request: req}, nil
+	})
+	return httpwares.TripperwareChain{
+		http_ctxtags.Tripperware(http_ctxtags.WithServiceName("backend")),
+		http_adaptive.Tripperware(limiter),
+	}.WrapClient(&http.Client{Transport: transport})
+}
+
+func get(client *http.Client) (*http.Response, error) {
+	req, _ := http.NewRequest("GET", "http://something.local/someurl", nil)
+	return client.Do(req)
+}
+
+func TestTripperwareRejectsOverLimit(t *testing.T) {
+	clock := httpwares_testing.NewFakeClock(time.Unix(1000, 0))
+	limiter := http_adaptive.NewLimiter(
+		http_adaptive.WithClock(clock.Now),
+		http_adaptive.WithLimit(func() http_adaptive.Limit {
+			return http_adaptive.NewAIMDLimit(2, 1, 2, 0.5, time.Second)
+		}),
+	)
+	client := adaptiveClient(limiter, clock, 10*time.Millisecond, http.StatusOK)
+	var open []*http.Response
+	for i := 0; i < 2; i++ {
+		resp, err := get(client)
+		require.NoError(t, err, "requests within the limit must succeed")
+		open = append(open, resp)
+	}
+	_, err := get(client)
+	require.Error(t, err, "requests over the limit must be rejected")
+	assert.True(t, http_adaptive.IsLimitedError(err), "the error must be typed, got %v", err)
+	assert.Equal(t, http_adaptive.Stats{Limit: 2, InFlight: 2, Rejected: 1}, limiter.Stats()["backend"], "the stats must be kept by service")
+	for _, resp := range open {
+		resp.Body.Close()
+	}
+	assert.Equal(t, 0, limiter.Stats()["backend"].InFlight, "slots must be released once bodies are closed")
+}
+
+func TestTripperwareBacksOffOnSlowAndFailingResponses(t *testing.T) {
+	clock := httpwares_testing.NewFakeClock(time.Unix(1000, 0))
+	newLimiter := func() *http_adaptive.Limiter {
+		return http_adaptive.NewLimiter(
+			http_adaptive.WithClock(clock.Now),
+			http_adaptive.WithLimit(func() http_adaptive.Limit {
+				return http_adaptive.NewAIMDLimit(16, 1, 100, 0.5, 50*time.Millisecond)
+			}),
+		)
+	}
+	for _, tcase := range []struct {
+		name    string
+		latency time.Duration
+		code    int
+	}{
+		{name: "slow", latency: 100 * time.Millisecond, code: http.StatusOK},
+		{name: "overloaded", latency: time.Millisecond, code: http.StatusServiceUnavailable},
+	} {
+		limiter := newLimiter()
+		client := adaptiveClient(limiter, clock, tcase.latency, tcase.code)
+		for i := 0; i < 3; i++ {
+			resp, err := get(client)
+			require.NoError(t, err, "requests within the limit must succeed")
+			resp.Body.Close()
+		}
+		assert.Equal(t, 2, limiter.Stats()["backend"].Limit, "the limit must back off for %v responses", tcase.name)
+	}
+}
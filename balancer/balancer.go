@@ -0,0 +1,211 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_balancer
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Balancer keeps the endpoints of services, and their state.
+//
+// A single Balancer is meant to be shared between Tripperwares, and is safe for concurrent use.
+type Balancer struct {
+	opts *options
+
+	mu       sync.RWMutex
+	services map[string]*endpointSet
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// Endpoint is a single replica of a service.
+type Endpoint struct {
+	outstanding int64 // accessed atomically, first for alignment.
+	host        string
+
+	// guarded by the lock of the set.
+	consecutiveFailures uint
+	ejectedUntil        time.Time
+	ejections           uint
+	unhealthy           bool
+	lastHealthCheck     time.Time
+	healthCheckError    string
+}
+
+// Host returns the host (and port) of the endpoint.
+func (e *Endpoint) Host() string {
+	return e.host
+}
+
+// Outstanding returns the number of requests to the endpoint in flight.
+func (e *Endpoint) Outstanding() int {
+	return int(atomic.LoadInt64(&e.outstanding))
+}
+
+// EndpointStats is a snapshot of the state of an endpoint, meant for metrics.
+type EndpointStats struct {
+	Host                string
+	Outstanding         int
+	ConsecutiveFailures uint
+	// Ejected is true if the endpoint is ejected for failing, until EjectedUntil.
+	Ejected      bool
+	EjectedUntil time.Time
+	// Ejections is the number of times in a row the endpoint was ejected, deciding the time of the next ejection.
+	Ejections uint
+	// Healthy is false if the endpoint failed its last health check, with the reason in HealthCheckError.
+	Healthy          bool
+	LastHealthCheck  time.Time
+	HealthCheckError string
+}
+
+type endpointSet struct {
+	mu        sync.Mutex
+	endpoints []*Endpoint
+	picker    Picker
+}
+
+// NewBalancer creates a new Balancer, without endpoints of any services.
+//
+// If health checks are turned on (see `WithHealthCheck`), they are started in the background.
+func NewBalancer(opts ...Option) *Balancer {
+	b := &Balancer{opts: evaluateOptions(opts), services: make(map[string]*endpointSet), done: make(chan struct{})}
+	if b.opts.healthCheckInterval > 0 {
+		go b.runHealthChecks()
+	}
+	return b
+}
+
+// Close stops the background health checks of the Balancer.
+func (b *Balancer) Close() {
+	b.closeOnce.Do(func() {
+		close(b.done)
+	})
+}
+
+// Update sets the endpoints of the service, given by their host (and port).
+//
+// The state of the endpoints that were already set for the service is kept. Setting no endpoints makes requests to the
+// service fail with a `*NoEndpointsError`.
+func (b *Balancer) Update(service string, hosts ...string) {
+	b.mu.Lock()
+	set, ok := b.services[service]
+	if !ok {
+		set = &endpointSet{picker: b.opts.pickerFunc()}
+		b.services[service] = set
+	}
+	b.mu.Unlock()
+
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	existing := make(map[string]*Endpoint, len(set.endpoints))
+	for _, endpoint := range set.endpoints {
+		existing[endpoint.host] = endpoint
+	}
+	endpoints := make([]*Endpoint, 0, len(hosts))
+	for _, host := range hosts {
+		endpoint, ok := existing[host]
+		if !ok {
+			endpoint = &Endpoint{host: host}
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	set.endpoints = endpoints
+}
+
+// Remove removes the endpoints of the service, so that requests to it are passed through unchanged.
+func (b *Balancer) Remove(service string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.services, service)
+}
+
+// Stats returns a snapshot of the state of the endpoints, by service.
+func (b *Balancer) Stats() map[string][]EndpointStats {
+	now := b.opts.clock()
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	stats := make(map[string][]EndpointStats, len(b.services))
+	for service, set := range b.services {
+		set.mu.Lock()
+		for _, endpoint := range set.endpoints {
+			stats[service] = append(stats[service], EndpointStats{
+				Host:                endpoint.host,
+				Outstanding:         endpoint.Outstanding(),
+				ConsecutiveFailures: endpoint.consecutiveFailures,
+				Ejected:             endpoint.isEjected(now),
+				EjectedUntil:        endpoint.ejectedUntil,
+				Ejections:           endpoint.ejections,
+				Healthy:             !endpoint.unhealthy,
+				LastHealthCheck:     endpoint.lastHealthCheck,
+				HealthCheckError:    endpoint.healthCheckError,
+			})
+		}
+		set.mu.Unlock()
+	}
+	return stats
+}
+
+func (b *Balancer) set(service string) *endpointSet {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.services[service]
+}
+
+// pick chooses the endpoint for a request from the healthy ones that are not ejected, or from all of them if there are
+// none.
+func (s *endpointSet) pick(now time.Time) *Endpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.endpoints) == 0 {
+		return nil
+	}
+	healthy := make([]*Endpoint, 0, len(s.endpoints))
+	for _, endpoint := range s.endpoints {
+		if !endpoint.unhealthy && !endpoint.isEjected(now) {
+			healthy = append(healthy, endpoint)
+		}
+	}
+	if len(healthy) == 0 {
+		healthy = s.endpoints
+	}
+	return s.picker.Pick(healthy)
+}
+
+// report records the outcome of a request to the endpoint, ejecting it if it failed too many times in a row.
+func (s *endpointSet) report(endpoint *Endpoint, failed bool, now time.Time, o *options) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !failed {
+		endpoint.consecutiveFailures = 0
+		return
+	}
+	endpoint.consecutiveFailures++
+	if o.consecutiveFailures > 0 && endpoint.consecutiveFailures >= o.consecutiveFailures {
+		endpoint.eject(now, o)
+	}
+}
+
+// eject takes the endpoint out of the set, for twice as long as the previous time if it was ejected recently.
+func (e *Endpoint) eject(now time.Time, o *options) {
+	if now.Sub(e.ejectedUntil) > o.maxEjectionTime {
+		e.ejections = 0 // the endpoint was fine for long enough, start over.
+	}
+	ejectionTime := o.ejectionTime
+	for i := uint(0); i < e.ejections && ejectionTime < o.maxEjectionTime; i++ {
+		ejectionTime *= 2
+	}
+	if ejectionTime > o.maxEjectionTime {
+		ejectionTime = o.maxEjectionTime
+	}
+	e.ejections++
+	e.ejectedUntil = now.Add(ejectionTime)
+	e.consecutiveFailures = 0
+}
+
+func (e *Endpoint) isEjected(now time.Time) bool {
+	return now.Before(e.ejectedUntil)
+}
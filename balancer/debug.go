@@ -0,0 +1,95 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_balancer
+
+import (
+	"html/template"
+	"net/http"
+	"sort"
+	"time"
+
+	"golang.org/x/net/trace"
+)
+
+// DebugHandler returns a http.Handler with a page showing the state of all endpoints of the Balancer.
+//
+// It is meant to be mounted next to the `/debug/requests` page of `http_debug`, e.g. at `/debug/endpoints`, and just
+// like it, it is only available to requests allowed by `trace.AuthRequest`.
+func DebugHandler(b *Balancer) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if allowed, _ := trace.AuthRequest(req); !allowed {
+			http.Error(resp, "not allowed", http.StatusUnauthorized)
+			return
+		}
+		page := &debugPage{Now: b.opts.clock()}
+		for name, endpoints := range b.Stats() {
+			page.Services = append(page.Services, debugService{Name: name, Endpoints: endpoints})
+		}
+		sort.Slice(page.Services, func(i, j int) bool { return page.Services[i].Name < page.Services[j].Name })
+		resp.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := debugTemplate.Execute(resp, page); err != nil {
+			http.Error(resp, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+type debugPage struct {
+	Now      time.Time
+	Services []debugService
+}
+
+type debugService struct {
+	Name      string
+	Endpoints []EndpointStats
+}
+
+var debugTemplate = template.Must(template.New("endpoints").Funcs(template.FuncMap{
+	"since": func(now time.Time, then time.Time) string {
+		if then.IsZero() {
+			return "never"
+		}
+		return roundToMilliseconds(now.Sub(then)) + " ago"
+	},
+	"until": func(now time.Time, then time.Time) string {
+		return roundToMilliseconds(then.Sub(now))
+	},
+}).Parse(`<html>
+<head>
+<title>/debug/endpoints</title>
+<style type="text/css">
+body { font-family: sans-serif; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { padding: 0.2em 0.6em; text-align: left; border-bottom: 1px solid #ddd; }
+.bad { color: #b00; }
+</style>
+</head>
+<body>
+<h1>/debug/endpoints</h1>
+{{$now := .Now}}
+{{range .Services}}
+<h2>{{.Name}}</h2>
+<table>
+<tr><th>Endpoint</th><th>In flight</th><th>Failures in a row</th><th>Ejected</th><th>Ejections</th><th>Health</th><th>Last check</th></tr>
+{{range .Endpoints}}
+<tr>
+<td>{{.Host}}</td>
+<td>{{.Outstanding}}</td>
+<td>{{.ConsecutiveFailures}}</td>
+<td>{{if .Ejected}}<span class="bad">for {{until $now .EjectedUntil}}</span>{{else}}no{{end}}</td>
+<td>{{.Ejections}}</td>
+<td>{{if .Healthy}}healthy{{else}}<span class="bad">unhealthy: {{.HealthCheckError}}</span>{{end}}</td>
+<td>{{since $now .LastHealthCheck}}</td>
+</tr>
+{{end}}
+</table>
+{{else}}
+<p>No services.</p>
+{{end}}
+</body>
+</html>
+`))
+
+func roundToMilliseconds(d time.Duration) string {
+	return (d / time.Millisecond * time.Millisecond).String()
+}
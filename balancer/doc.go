@@ -0,0 +1,34 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+/*
+`http_balancer` is a HTTP client-side Tripperware that balances requests across the replicas of a service.
+
+Instead of calling a single load balancer, requests to a service are spread over its endpoints by rewriting the host
+of their URL. The service is identified by the `http.call.service` tag set by `http_ctxtags.Tripperware`, or by the
+host of the request if the tag is not set, and its endpoints are kept in a `Balancer`. The endpoints of a service can be
+updated at any time, e.g. from service discovery, keeping the state of the endpoints that stay in the set. Requests to
+services without endpoints set are passed through unchanged.
+
+Picking Endpoints
+
+The endpoint of every request is chosen by a `Picker` of the service: `NewRoundRobin` takes the endpoints in turns,
+`NewLeastOutstanding` takes the one with the fewest requests in flight, and `NewPowerOfTwoChoices` takes the one with
+fewer requests in flight of two random ones. Requests are in flight until their response body is closed.
+
+Health Tracking
+
+Endpoints that fail a number of requests in a row are ejected from the set for some time (see `WithEjection`), and
+are not picked until it passes. Endpoints ejected again soon after are ejected for twice as long every time, up to
+`WithMaxEjectionTime`. Responses that are too slow can count as failures too (see `WithLatencyThreshold`).
+
+On top of that, the health of all endpoints can be checked actively in the background with requests to a health check
+path (see `WithHealthCheck`). Endpoints failing their checks are not picked until they pass one.
+
+If none of the endpoints of a service are healthy, requests are spread across all of them anyway, as failing fast
+wouldn't be any better. The state of all endpoints is shown by the `DebugHandler` page, in the style of the
+`/debug/requests` page of `http_debug`.
+
+The host of the chosen endpoint is recorded in the `http.balancer.endpoint` tag.
+*/
+package http_balancer
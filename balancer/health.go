@@ -0,0 +1,84 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_balancer
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// runHealthChecks checks the health of all endpoints every interval, until the Balancer is closed.
+func (b *Balancer) runHealthChecks() {
+	client := b.opts.healthCheckClient
+	if client == nil {
+		client = &http.Client{Timeout: b.opts.healthCheckInterval}
+	}
+	ticker := time.NewTicker(b.opts.healthCheckInterval)
+	defer ticker.Stop()
+	for {
+		b.checkHealth(client)
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkHealth checks the health of all endpoints at once, waiting for all the checks to finish.
+func (b *Balancer) checkHealth(client *http.Client) {
+	type check struct {
+		set      *endpointSet
+		endpoint *Endpoint
+	}
+	var checks []check
+	b.mu.RLock()
+	for _, set := range b.services {
+		set.mu.Lock()
+		for _, endpoint := range set.endpoints {
+			checks = append(checks, check{set: set, endpoint: endpoint})
+		}
+		set.mu.Unlock()
+	}
+	b.mu.RUnlock()
+
+	wg := &sync.WaitGroup{}
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c check) {
+			defer wg.Done()
+			err := b.checkEndpoint(client, c.endpoint)
+			c.set.mu.Lock()
+			defer c.set.mu.Unlock()
+			c.endpoint.lastHealthCheck = b.opts.clock()
+			c.endpoint.unhealthy = err != nil
+			c.endpoint.healthCheckError = ""
+			if err != nil {
+				c.endpoint.healthCheckError = err.Error()
+			}
+		}(c)
+	}
+	wg.Wait()
+}
+
+func (b *Balancer) checkEndpoint(client *http.Client, endpoint *Endpoint) error {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s://%s%s", b.opts.healthCheckScheme, endpoint.host, b.opts.healthCheckPath), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+	if resp.StatusCode != b.opts.healthCheckStatus {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
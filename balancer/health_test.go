@@ -0,0 +1,143 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_balancer_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/balancer"
+	"github.com/mwitkow/go-httpwares/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// healthServer is an endpoint whose health check status can be changed.
+type healthServer struct {
+	*httptest.Server
+	status int32
+}
+
+func newHealthServer() *healthServer {
+	s := &healthServer{status: http.StatusOK}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/healthz" {
+			resp.WriteHeader(int(atomic.LoadInt32(&s.status)))
+			return
+		}
+		resp.WriteHeader(http.StatusOK)
+	}))
+	return s
+}
+
+func (s *healthServer) host() string {
+	u, _ := url.Parse(s.URL)
+	return u.Host
+}
+
+func waitForHealth(t *testing.T, b *http_balancer.Balancer, host string, healthy bool) {
+	for i := 0; i < 200; i++ {
+		for _, stats := range b.Stats()["backend"] {
+			if stats.Host == host && stats.Healthy == healthy && !stats.LastHealthCheck.IsZero() {
+				return
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("endpoint %v didn't become healthy=%v", host, healthy)
+}
+
+func TestBalancerChecksHealthActively(t *testing.T) {
+	good := newHealthServer()
+	defer good.Close()
+	bad := newHealthServer()
+	defer bad.Close()
+	atomic.StoreInt32(&bad.status, http.StatusServiceUnavailable)
+
+	b := http_balancer.NewBalancer(http_balancer.WithHealthCheck("/healthz", 5*time.Millisecond, http.StatusOK))
+	defer b.Close()
+	b.Update("backend", good.host(), bad.host())
+	waitForHealth(t, b, bad.host(), false)
+	waitForHealth(t, b, good.host(), true)
+
+	transport := &endpointsTransport{}
+	client := balancedClient(b, transport)
+	getAndClose(t, client, 4)
+	for _, host := range transport.reset() {
+		assert.Equal(t, good.host(), host, "unhealthy endpoints must not be picked")
+	}
+
+	atomic.StoreInt32(&bad.status, http.StatusOK)
+	waitForHealth(t, b, bad.host(), true)
+	getAndClose(t, client, 4)
+	assert.Contains(t, transport.reset(), bad.host(), "endpoints must be picked again once healthy")
+}
+
+func TestBalancerBacksOffEjections(t *testing.T) {
+	clock := httpwares_testing.NewFakeClock(time.Now())
+	b := http_balancer.NewBalancer(
+		http_balancer.WithEjection(1, 10*time.Second),
+		http_balancer.WithMaxEjectionTime(30*time.Second),
+		http_balancer.WithClock(clock.Now),
+	)
+	b.Update("backend", "10.0.0.1:80")
+	client := balancedClient(b, &endpointsTransport{codes: map[string]int{"10.0.0.1:80": http.StatusInternalServerError}})
+	for _, expected := range []time.Duration{10 * time.Second, 20 * time.Second, 30 * time.Second, 30 * time.Second} {
+		getAndClose(t, client, 1)
+		stats := b.Stats()["backend"][0]
+		require.True(t, stats.Ejected, "failing endpoints must be ejected")
+		assert.Equal(t, expected, stats.EjectedUntil.Sub(clock.Now()), "the ejection time must double up to the maximum")
+		clock.Advance(expected)
+	}
+	clock.Advance(31 * time.Second)
+	getAndClose(t, client, 1)
+	assert.Equal(t, 10*time.Second, b.Stats()["backend"][0].EjectedUntil.Sub(clock.Now()), "the ejection time must start over after a while")
+}
+
+func TestBalancerEjectsSlowEndpoints(t *testing.T) {
+	clock := httpwares_testing.NewFakeClock(time.Now())
+	b := http_balancer.NewBalancer(
+		http_balancer.WithEjection(2, 10*time.Second),
+		http_balancer.WithLatencyThreshold(time.Second),
+		http_balancer.WithClock(clock.Now),
+	)
+	b.Update("backend", "10.0.0.1:80")
+	transport := &endpointsTransport{}
+	client := balancedClient(b, slowTransport(transport, clock, 2*time.Second))
+	getAndClose(t, client, 2)
+	assert.True(t, b.Stats()["backend"][0].Ejected, "endpoints that keep being slow must be ejected")
+}
+
+func slowTransport(next http.RoundTripper, clock *httpwares_testing.FakeClock, latency time.Duration) http.RoundTripper {
+	return httpwares.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		clock.Advance(latency)
+		return next.RoundTrip(req)
+	})
+}
+
+func TestDebugHandlerShowsEndpoints(t *testing.T) {
+	clock := httpwares_testing.NewFakeClock(time.Now())
+	b := http_balancer.NewBalancer(http_balancer.WithEjection(1, time.Minute), http_balancer.WithClock(clock.Now))
+	b.Update("backend", "10.0.0.1:80", "10.0.0.2:80")
+	getAndClose(t, balancedClient(b, &endpointsTransport{codes: map[string]int{"10.0.0.1:80": http.StatusInternalServerError}}), 1)
+
+	req := httptest.NewRequest("GET", "/debug/endpoints", nil)
+	req.RemoteAddr = "127.0.0.1:1234"
+	resp := httptest.NewRecorder()
+	http_balancer.DebugHandler(b).ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), "<h2>backend</h2>", "services must be listed")
+	assert.Contains(t, resp.Body.String(), "10.0.0.2:80", "endpoints must be listed")
+	assert.Contains(t, resp.Body.String(), `<span class="bad">for 1m0s</span>`, "ejections must be shown")
+
+	req.RemoteAddr = "10.1.1.1:1234"
+	resp = httptest.NewRecorder()
+	http_balancer.DebugHandler(b).ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code, "remote requests must not be allowed by default")
+}
@@ -0,0 +1,140 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_balancer
+
+import (
+	"net/http"
+	"time"
+)
+
+var (
+	defaultOptions = &options{
+		pickerFunc:          NewRoundRobin,
+		failureFunc:         DefaultResponseFailure,
+		consecutiveFailures: 5,
+		ejectionTime:        30 * time.Second,
+		maxEjectionTime:     5 * time.Minute,
+		healthCheckScheme:   "http",
+		clock:               time.Now,
+	}
+)
+
+type options struct {
+	pickerFunc          func() Picker
+	failureFunc         ResponseFailureFunc
+	consecutiveFailures uint
+	ejectionTime        time.Duration
+	maxEjectionTime     time.Duration
+	latencyThreshold    time.Duration
+
+	healthCheckPath     string
+	healthCheckInterval time.Duration
+	healthCheckStatus   int
+	healthCheckScheme   string
+	healthCheckClient   *http.Client
+
+	clock func() time.Time
+}
+
+func evaluateOptions(opts []Option) *options {
+	optCopy := &options{}
+	*optCopy = *defaultOptions
+	for _, o := range opts {
+		o(optCopy)
+	}
+	return optCopy
+}
+
+type Option func(*options)
+
+// ResponseFailureFunc decides whether the response counts as a failure of the endpoint (on true).
+type ResponseFailureFunc func(resp *http.Response) bool
+
+// WithPicker sets the constructor of the Picker used for every service, `NewRoundRobin` by default.
+func WithPicker(f func() Picker) Option {
+	return func(o *options) {
+		o.pickerFunc = f
+	}
+}
+
+// WithResponseFailure is a function option that decides which responses count as failures of the endpoint.
+//
+// Errors returned by the next RoundTripper always count as failures, unless the request was cancelled by the caller.
+func WithResponseFailure(f ResponseFailureFunc) Option {
+	return func(o *options) {
+		o.failureFunc = f
+	}
+}
+
+// WithEjection sets the number of consecutive failures after which an endpoint is ejected, and for how long.
+//
+// Every time an endpoint is ejected again the ejection time doubles, up to the maximum ejection time (see
+// `WithMaxEjectionTime`). By default endpoints are ejected for 30 seconds after 5 failures, setting the failures to 0
+// disables ejection.
+func WithEjection(consecutiveFailures uint, ejectionTime time.Duration) Option {
+	return func(o *options) {
+		o.consecutiveFailures = consecutiveFailures
+		o.ejectionTime = ejectionTime
+	}
+}
+
+// WithMaxEjectionTime sets the maximum time an endpoint is ejected for, 5 minutes by default.
+//
+// Endpoints that were not ejected for that long start over from the ejection time set with `WithEjection`.
+func WithMaxEjectionTime(maxEjectionTime time.Duration) Option {
+	return func(o *options) {
+		o.maxEjectionTime = maxEjectionTime
+	}
+}
+
+// WithLatencyThreshold makes responses that took longer than the threshold count as failures of the endpoint.
+//
+// This ejects endpoints that keep being slow, not only the ones that fail. The latency is measured until the headers of
+// the response are received. By default the latency is not taken into account.
+func WithLatencyThreshold(threshold time.Duration) Option {
+	return func(o *options) {
+		o.latencyThreshold = threshold
+	}
+}
+
+// WithHealthCheck turns on active health checks of all endpoints, sent in the background every interval.
+//
+// The checks are GET requests to the given path of every endpoint, which is healthy if it responds with the expected
+// status code. Unhealthy endpoints are not picked until they pass a check again. The background checks are stopped by
+// `Balancer.Close`.
+func WithHealthCheck(path string, interval time.Duration, expectedStatus int) Option {
+	return func(o *options) {
+		o.healthCheckPath = path
+		o.healthCheckInterval = interval
+		o.healthCheckStatus = expectedStatus
+	}
+}
+
+// WithHealthCheckScheme sets the scheme of the health check requests, "http" by default.
+func WithHealthCheckScheme(scheme string) Option {
+	return func(o *options) {
+		o.healthCheckScheme = scheme
+	}
+}
+
+// WithHealthCheckClient sets the client sending the health check requests.
+//
+// By default a client with a timeout of the health check interval is used.
+func WithHealthCheckClient(client *http.Client) Option {
+	return func(o *options) {
+		o.healthCheckClient = client
+	}
+}
+
+// WithClock sets the source of time used for ejecting endpoints and measuring latency, meant for tests.
+func WithClock(now func() time.Time) Option {
+	return func(o *options) {
+		o.clock = now
+	}
+}
+
+// DefaultResponseFailure is the default implementation of the failure classifier, treating all 5xx as failures.
+func DefaultResponseFailure(resp *http.Response) bool {
+	return resp.StatusCode >= 500
+}
@@ -0,0 +1,77 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_balancer
+
+import (
+	"math/rand"
+)
+
+// Picker chooses the endpoint for a request.
+//
+// Every service has its own Picker, and it is called with the lock of the service held, so it doesn't need to be
+// safe for concurrent use.
+type Picker interface {
+	// Pick returns one of the given endpoints, of which there is at least one.
+	Pick(endpoints []*Endpoint) *Endpoint
+}
+
+type roundRobin struct {
+	next int
+}
+
+// NewRoundRobin returns a Picker that takes the endpoints in turns.
+func NewRoundRobin() Picker {
+	return &roundRobin{}
+}
+
+func (p *roundRobin) Pick(endpoints []*Endpoint) *Endpoint {
+	endpoint := endpoints[p.next%len(endpoints)]
+	p.next = (p.next + 1) % len(endpoints)
+	return endpoint
+}
+
+type leastOutstanding struct{}
+
+// NewLeastOutstanding returns a Picker that takes the endpoint with the fewest requests in flight.
+//
+// Ties are broken at random, so that idle endpoints share the load.
+func NewLeastOutstanding() Picker {
+	return &leastOutstanding{}
+}
+
+func (p *leastOutstanding) Pick(endpoints []*Endpoint) *Endpoint {
+	offset := rand.Intn(len(endpoints))
+	var best *Endpoint
+	for i := range endpoints {
+		endpoint := endpoints[(offset+i)%len(endpoints)]
+		if best == nil || endpoint.Outstanding() < best.Outstanding() {
+			best = endpoint
+		}
+	}
+	return best
+}
+
+type powerOfTwoChoices struct{}
+
+// NewPowerOfTwoChoices returns a Picker that takes the endpoint with fewer requests in flight of two random ones.
+//
+// It spreads the load nearly as well as `NewLeastOutstanding`, while avoiding all clients herding onto the same endpoint.
+func NewPowerOfTwoChoices() Picker {
+	return &powerOfTwoChoices{}
+}
+
+func (p *powerOfTwoChoices) Pick(endpoints []*Endpoint) *Endpoint {
+	if len(endpoints) == 1 {
+		return endpoints[0]
+	}
+	first := rand.Intn(len(endpoints))
+	second := rand.Intn(len(endpoints) - 1)
+	if second >= first {
+		second++
+	}
+	if endpoints[second].Outstanding() < endpoints[first].Outstanding() {
+		return endpoints[second]
+	}
+	return endpoints[first]
+}
@@ -0,0 +1,87 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_balancer
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/internal"
+	"github.com/mwitkow/go-httpwares/tags"
+)
+
+const (
+	// TagForEndpoint is a string naming the ctxtag with the host of the endpoint chosen for a request.
+	TagForEndpoint = "http.balancer.endpoint"
+)
+
+// NoEndpointsError is returned by the Tripperware for requests to services that have no endpoints.
+type NoEndpointsError struct {
+	// Service is the name of the service (or the host) the endpoints are kept for.
+	Service string
+}
+
+func (e *NoEndpointsError) Error() string {
+	return fmt.Sprintf("http_balancer: no endpoints of %v", e.Service)
+}
+
+// IsNoEndpointsError checks whether the error, possibly returned from `http.Client`, is caused by a lack of endpoints.
+func IsNoEndpointsError(err error) bool {
+	_, ok := http_internal.UnwrapURLError(err).(*NoEndpointsError)
+	return ok
+}
+
+// Tripperware is client side HTTP ware that sends requests to one of the endpoints of their service.
+//
+// The host of the URL is replaced with the endpoint's, while the `Host` header of the request is kept. It needs to be
+// placed after `http_ctxtags.Tripperware` in the chain for the endpoints to be kept by service name.
+func Tripperware(b *Balancer) httpwares.Tripperware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return httpwares.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			service := http_ctxtags.ServiceName(req)
+			set := b.set(service)
+			if set == nil {
+				return next.RoundTrip(req)
+			}
+			endpoint := set.pick(b.opts.clock())
+			if endpoint == nil {
+				return nil, &NoEndpointsError{Service: service}
+			}
+			http_ctxtags.ExtractOutbound(req).Set(TagForEndpoint, endpoint.host)
+			atomic.AddInt64(&endpoint.outstanding, 1)
+			release := func() {
+				atomic.AddInt64(&endpoint.outstanding, -1)
+			}
+			startTime := b.opts.clock()
+			resp, err := next.RoundTrip(withHost(req, endpoint.host))
+			now := b.opts.clock()
+			if err != nil {
+				if req.Context().Err() == nil { // the caller giving up is not the endpoint's fault.
+					set.report(endpoint, true, now, b.opts)
+				}
+				release()
+				return resp, err
+			}
+			tooSlow := b.opts.latencyThreshold > 0 && now.Sub(startTime) > b.opts.latencyThreshold
+			set.report(endpoint, tooSlow || b.opts.failureFunc(resp), now, b.opts)
+			if resp.Body == nil {
+				release()
+				return resp, err
+			}
+			resp.Body = http_internal.ReleaseOnCloseBody(resp.Body, release)
+			return resp, err
+		})
+	}
+}
+
+// withHost returns a copy of the request, sent to the given host.
+func withHost(req *http.Request, host string) *http.Request {
+	hostReq := req.WithContext(req.Context()) // make a copy.
+	u := *req.URL
+	u.Host = host
+	hostReq.URL = &u
+	return hostReq
+}
@@ -0,0 +1,157 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_balancer_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/balancer"
+	"github.com/mwitkow/go-httpwares/tags"
+	"github.com/mwitkow/go-httpwares/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// endpointsTransport responds with the status code set for the host, recording the hosts requests were sent to.
+type endpointsTransport struct {
+	mu    sync.Mutex
+	hosts []string
+	codes map[string]int
+}
+
+func (t *endpointsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.hosts = append(t.hosts, req.URL.Host)
+	code := http.StatusOK
+	if c, ok := t.codes[req.URL.Host]; ok {
+		code = c
+	}
+	return &http.Response{StatusCode: code, Body: ioutil.NopCloser(strings.NewReader("")), Request: req}, nil
+}
+
+func (t *endpointsTransport) reset() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	hosts := t.hosts
+	t.hosts = nil
+	return hosts
+}
+
+func balancedClient(b *http_balancer.Balancer, transport http.RoundTripper) *http.Client {
+	return httpwares.TripperwareChain{
+		http_ctxtags.Tripperware(http_ctxtags.WithServiceName("backend")),
+		http_balancer.Tripperware(b),
+	}.WrapClient(&http.Client{Transport: transport})
+}
+
+func get(t *testing.T, client *http.Client) (*http.Response, map[string]interface{}) {
+	req, _ := http.NewRequest("GET", "http://backend.local/someurl", nil)
+	tags := http_ctxtags.ExtractOutbound(req)
+	resp, err := client.Do(http_ctxtags.SetOutboundInRequest(req, tags))
+	require.NoError(t, err, "call shouldn't fail")
+	return resp, tags.Values()
+}
+
+func getAndClose(t *testing.T, client *http.Client, times int) {
+	for i := 0; i < times; i++ {
+		resp, _ := get(t, client)
+		resp.Body.Close()
+	}
+}
+
+func TestTripperwareRoundRobin(t *testing.T) {
+	b := http_balancer.NewBalancer()
+	b.Update("backend", "10.0.0.1:80", "10.0.0.2:80", "10.0.0.3:80")
+	transport := &endpointsTransport{}
+	client := balancedClient(b, transport)
+	resp, tags := get(t, client)
+	resp.Body.Close()
+	assert.Equal(t, "backend.local", resp.Request.Host, "the host header must be kept")
+	assert.Equal(t, "10.0.0.1:80", tags[http_balancer.TagForEndpoint], "the endpoint must be tagged")
+	getAndClose(t, client, 5)
+	assert.Equal(t, []string{"10.0.0.1:80", "10.0.0.2:80", "10.0.0.3:80", "10.0.0.1:80", "10.0.0.2:80", "10.0.0.3:80"}, transport.reset(), "endpoints must be taken in turns")
+}
+
+func TestTripperwarePicksLeastLoaded(t *testing.T) {
+	for name, picker := range map[string]func() http_balancer.Picker{
+		"least outstanding":    http_balancer.NewLeastOutstanding,
+		"power of two choices": http_balancer.NewPowerOfTwoChoices,
+	} {
+		t.Run(name, func(t *testing.T) {
+			b := http_balancer.NewBalancer(http_balancer.WithPicker(picker))
+			b.Update("backend", "10.0.0.1:80", "10.0.0.2:80")
+			transport := &endpointsTransport{}
+			client := balancedClient(b, transport)
+			open, tags := get(t, client)
+			busy := tags[http_balancer.TagForEndpoint]
+			transport.reset()
+			getAndClose(t, client, 5)
+			for _, host := range transport.reset() {
+				assert.NotEqual(t, busy, host, "the endpoint with a request in flight must not be picked")
+			}
+			assert.Equal(t, 1, outstanding(b, busy.(string)), "requests must be in flight until the body is closed")
+			open.Body.Close()
+			assert.Equal(t, 0, outstanding(b, busy.(string)), "requests must not be in flight once the body is closed")
+		})
+	}
+}
+
+func outstanding(b *http_balancer.Balancer, host string) int {
+	for _, stats := range b.Stats()["backend"] {
+		if stats.Host == host {
+			return stats.Outstanding
+		}
+	}
+	return -1
+}
+
+func TestTripperwareEjectsFailingEndpoints(t *testing.T) {
+	clock := httpwares_testing.NewFakeClock(time.Now())
+	b := http_balancer.NewBalancer(http_balancer.WithEjection(2, time.Minute), http_balancer.WithClock(clock.Now))
+	b.Update("backend", "10.0.0.1:80", "10.0.0.2:80")
+	transport := &endpointsTransport{codes: map[string]int{"10.0.0.2:80": http.StatusServiceUnavailable}}
+	client := balancedClient(b, transport)
+	getAndClose(t, client, 4)
+	transport.reset()
+	getAndClose(t, client, 4)
+	assert.Equal(t, []string{"10.0.0.1:80", "10.0.0.1:80", "10.0.0.1:80", "10.0.0.1:80"}, transport.reset(), "the failing endpoint must be ejected")
+	assert.True(t, b.Stats()["backend"][1].Ejected, "the ejection must be visible in the stats")
+
+	b.Update("backend", "10.0.0.2:80", "10.0.0.3:80")
+	assert.True(t, b.Stats()["backend"][0].Ejected, "the state of endpoints must be kept across updates")
+
+	clock.Advance(time.Minute)
+	getAndClose(t, client, 2)
+	assert.Contains(t, transport.reset(), "10.0.0.2:80", "the endpoint must be picked again after the ejection time")
+}
+
+func TestTripperwareUsesEjectedEndpointsIfAllAre(t *testing.T) {
+	b := http_balancer.NewBalancer(http_balancer.WithEjection(1, time.Minute))
+	b.Update("backend", "10.0.0.1:80")
+	transport := &endpointsTransport{codes: map[string]int{"10.0.0.1:80": http.StatusInternalServerError}}
+	client := balancedClient(b, transport)
+	getAndClose(t, client, 2)
+	assert.Len(t, transport.reset(), 2, "requests must be sent even if all endpoints are ejected")
+}
+
+func TestTripperwareWithoutEndpoints(t *testing.T) {
+	b := http_balancer.NewBalancer()
+	transport := &endpointsTransport{}
+	client := balancedClient(b, transport)
+	getAndClose(t, client, 1)
+	assert.Equal(t, []string{"backend.local"}, transport.reset(), "requests to unknown services must be passed through")
+
+	b.Update("backend")
+	req, _ := http.NewRequest("GET", "http://backend.local/someurl", nil)
+	_, err := client.Do(req)
+	require.Error(t, err, "requests to services without endpoints must fail")
+	assert.True(t, http_balancer.IsNoEndpointsError(err), "the error must be typed, got %v", err)
+}
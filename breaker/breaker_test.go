@@ -0,0 +1,161 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_breaker_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/breaker"
+	"github.com/mwitkow/go-httpwares/tags"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// statusTransport is a fake RoundTripper returning the status codes set in it.
+type statusTransport struct {
+	mu    sync.Mutex
+	codes map[string]int
+	calls int
+}
+
+func (s *statusTransport) set(host string, code int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.codes[host] = code
+}
+
+func (s *statusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	return &http.Response{StatusCode: s.codes[req.URL.Host], Body: ioutil.NopCloser(strings.NewReader("")), Request: req}, nil
+}
+
+type transitionRecorder struct {
+	mu          sync.Mutex
+	transitions []string
+}
+
+func (r *transitionRecorder) record(service string, from http_breaker.State, to http_breaker.State) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.transitions = append(r.transitions, service+": "+from.String()+" -> "+to.String())
+}
+
+func breakerClient(transport http.RoundTripper, opts ...http_breaker.Option) *http.Client {
+	return httpwares.TripperwareChain{
+		http_ctxtags.Tripperware(),
+		http_breaker.Tripperware(opts...),
+	}.WrapClient(&http.Client{Transport: transport})
+}
+
+func get(client *http.Client, host string) (int, error) {
+	req, _ := http.NewRequest("GET", "http://"+host+"/someurl", nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func TestBreakerTripsOnConsecutiveFailures(t *testing.T) {
+	transport := &statusTransport{codes: map[string]int{"api.flaky.com": 503, "api.healthy.com": 200}}
+	recorder := &transitionRecorder{}
+	client := breakerClient(transport,
+		http_breaker.WithConsecutiveFailures(3),
+		http_breaker.WithFailureRatio(0, 0, time.Second),
+		http_breaker.WithStateChangeCallback(recorder.record),
+	)
+	for i := 0; i < 3; i++ {
+		code, err := get(client, "api.flaky.com")
+		require.NoError(t, err, "requests must be let through while closed")
+		assert.Equal(t, 503, code)
+	}
+	_, err := get(client, "api.flaky.com")
+	require.Error(t, err, "the breaker must be open")
+	assert.True(t, http_breaker.IsOpenError(err), "the error must be typed, got %v", err)
+	assert.Equal(t, 3, transport.calls, "requests must not reach the service while open")
+
+	code, err := get(client, "api.healthy.com")
+	require.NoError(t, err, "breakers of other services must not be affected")
+	assert.Equal(t, 200, code)
+	assert.Equal(t, []string{"flaky: closed -> open"}, recorder.transitions, "the state change must be reported")
+}
+
+func TestBreakerTripsOnFailureRatio(t *testing.T) {
+	transport := &statusTransport{codes: map[string]int{}}
+	client := breakerClient(transport,
+		http_breaker.WithConsecutiveFailures(0),
+		http_breaker.WithFailureRatio(0.5, 4, time.Minute),
+	)
+	for _, code := range []int{200, 503, 200, 503} {
+		transport.set("api.flaky.com", code)
+		_, err := get(client, "api.flaky.com")
+		require.NoError(t, err, "requests must be let through below the min requests")
+	}
+	_, err := get(client, "api.flaky.com")
+	assert.True(t, http_breaker.IsOpenError(err), "the breaker must trip at the failure ratio")
+}
+
+func TestBreakerClosesAfterSuccessfulProbe(t *testing.T) {
+	transport := &statusTransport{codes: map[string]int{"api.flaky.com": 503}}
+	recorder := &transitionRecorder{}
+	client := breakerClient(transport,
+		http_breaker.WithConsecutiveFailures(1),
+		http_breaker.WithOpenTimeout(20*time.Millisecond),
+		http_breaker.WithStateChangeCallback(recorder.record),
+	)
+	get(client, "api.flaky.com")
+	_, err := get(client, "api.flaky.com")
+	require.True(t, http_breaker.IsOpenError(err), "the breaker must be open")
+
+	time.Sleep(30 * time.Millisecond)
+	code, err := get(client, "api.flaky.com")
+	require.NoError(t, err, "a probe must be let through after the open timeout")
+	assert.Equal(t, 503, code)
+	_, err = get(client, "api.flaky.com")
+	require.True(t, http_breaker.IsOpenError(err), "a failed probe must open the breaker again")
+
+	time.Sleep(30 * time.Millisecond)
+	transport.set("api.flaky.com", 200)
+	for i := 0; i < 2; i++ {
+		code, err = get(client, "api.flaky.com")
+		require.NoError(t, err, "the breaker must close after a successful probe")
+		assert.Equal(t, 200, code)
+	}
+	assert.Equal(t, []string{
+		"flaky: closed -> open",
+		"flaky: open -> half-open",
+		"flaky: half-open -> open",
+		"flaky: open -> half-open",
+		"flaky: half-open -> closed",
+	}, recorder.transitions, "all state changes must be reported")
+}
+
+func TestBreakerAlwaysLetsProbesThrough(t *testing.T) {
+	transport := &statusTransport{codes: map[string]int{"api.flaky.com": 503}}
+	client := breakerClient(transport,
+		http_breaker.WithConsecutiveFailures(1),
+		http_breaker.WithOpenTimeout(20*time.Millisecond),
+		http_breaker.WithHalfOpenRequests(0),
+	)
+	get(client, "api.flaky.com")
+	_, err := get(client, "api.flaky.com")
+	require.True(t, http_breaker.IsOpenError(err), "the breaker must be open")
+
+	time.Sleep(30 * time.Millisecond)
+	transport.set("api.flaky.com", 200)
+	for i := 0; i < 2; i++ {
+		code, err := get(client, "api.flaky.com")
+		require.NoError(t, err, "a probe must be let through even with 0 half-open requests")
+		assert.Equal(t, 200, code)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_breaker
+
+import (
+	"sync"
+	"time"
+)
+
+// State is the state of a circuit breaker.
+type State int
+
+const (
+	// StateClosed lets all requests through.
+	StateClosed State = iota
+	// StateOpen fails all requests fast.
+	StateOpen
+	// StateHalfOpen lets a limited number of probe requests through.
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+type outcome int
+
+const (
+	outcomeSuccess outcome = iota
+	outcomeFailure
+	outcomeIgnored
+)
+
+type transition struct {
+	from State
+	to   State
+}
+
+// circuit is the state machine of a breaker of a single service.
+type circuit struct {
+	opts *options
+
+	mu                  sync.Mutex
+	state               State
+	generation          uint64 // changes on every transition, so that outcomes of older requests are ignored.
+	openedAt            time.Time
+	windowStart         time.Time
+	requests            uint
+	failures            uint
+	consecutiveFailures uint
+	halfOpenInFlight    uint
+	halfOpenSuccesses   uint
+}
+
+// allow checks whether a request can be made, returning the generation the outcome of the request belongs to.
+func (c *circuit) allow(now time.Time) (State, uint64, bool, *transition) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var t *transition
+	if c.state == StateOpen && now.Sub(c.openedAt) >= c.opts.openTimeout {
+		t = c.setState(StateHalfOpen, now)
+	}
+	switch c.state {
+	case StateOpen:
+		return c.state, c.generation, false, t
+	case StateHalfOpen:
+		if c.halfOpenInFlight >= c.opts.halfOpenRequests {
+			return c.state, c.generation, false, t
+		}
+		c.halfOpenInFlight++
+	}
+	return c.state, c.generation, true, t
+}
+
+// record updates the state with the outcome of a request allowed in the given generation.
+func (c *circuit) record(generation uint64, result outcome, now time.Time) *transition {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return nil
+	}
+	switch c.state {
+	case StateClosed:
+		if result == outcomeIgnored {
+			return nil
+		}
+		if now.Sub(c.windowStart) >= c.opts.window {
+			c.windowStart = now
+			c.requests, c.failures = 0, 0
+		}
+		c.requests++
+		if result == outcomeSuccess {
+			c.consecutiveFailures = 0
+			return nil
+		}
+		c.failures++
+		c.consecutiveFailures++
+		if c.shouldTrip() {
+			return c.setState(StateOpen, now)
+		}
+	case StateHalfOpen:
+		c.halfOpenInFlight--
+		switch result {
+		case outcomeFailure:
+			return c.setState(StateOpen, now)
+		case outcomeSuccess:
+			c.halfOpenSuccesses++
+			if c.halfOpenSuccesses >= c.opts.halfOpenRequests {
+				return c.setState(StateClosed, now)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *circuit) shouldTrip() bool {
+	if c.opts.consecutiveFailures > 0 && c.consecutiveFailures >= c.opts.consecutiveFailures {
+		return true
+	}
+	return c.opts.failureRatio > 0 && c.requests >= c.opts.minRequests &&
+		float64(c.failures)/float64(c.requests) >= c.opts.failureRatio
+}
+
+func (c *circuit) setState(state State, now time.Time) *transition {
+	t := &transition{from: c.state, to: state}
+	c.state = state
+	c.generation++
+	c.openedAt = now
+	c.windowStart = now
+	c.requests, c.failures, c.consecutiveFailures = 0, 0, 0
+	c.halfOpenInFlight, c.halfOpenSuccesses = 0, 0
+	return t
+}
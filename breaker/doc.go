@@ -0,0 +1,26 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+/*
+`http_breaker` is a HTTP client-side Tripperware that stops calling services that keep failing.
+
+A separate circuit breaker is kept for each service, identified by the `http.call.service` tag set by
+`http_ctxtags.Tripperware`, or by the host of the request if the tag is not set.
+
+States
+
+A breaker starts closed, letting all requests through and counting their failures. Errors and responses discarded by
+the `http_retry.ResponseDiscarderFunc` (by default 5xx, see `WithResponseDiscarder`) are failures. The breaker trips
+open once either of the thresholds is reached: a number of consecutive failures (`WithConsecutiveFailures`) or a ratio
+of failed requests within a time window (`WithFailureRatio`).
+
+While open, requests fail fast with an `*OpenError`, without reaching the service. After the open timeout passes, the
+breaker becomes half-open and lets a limited number of probe requests through. If they succeed, the breaker closes
+again, and if any of them fails it opens for another timeout.
+
+Reporting
+
+State changes can be observed with `WithStateChangeCallback`, e.g. to log them or export them as metrics. Every request
+passing through the Tripperware also has the state of its breaker recorded in the `http.breaker.state` outbound ctxtag.
+*/
+package http_breaker
@@ -0,0 +1,116 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_breaker
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/mwitkow/go-httpwares/retry"
+)
+
+var (
+	defaultOptions = &options{
+		discarder:           DefaultResponseDiscarder,
+		consecutiveFailures: 5,
+		failureRatio:        0.5,
+		minRequests:         20,
+		window:              10 * time.Second,
+		openTimeout:         30 * time.Second,
+		halfOpenRequests:    1,
+	}
+)
+
+type options struct {
+	discarder           http_retry.ResponseDiscarderFunc
+	consecutiveFailures uint
+	failureRatio        float64
+	minRequests         uint
+	window              time.Duration
+	openTimeout         time.Duration
+	halfOpenRequests    uint
+	stateChangeCallback StateChangeFunc
+}
+
+func evaluateOptions(opts []Option) *options {
+	optCopy := &options{}
+	*optCopy = *defaultOptions
+	for _, o := range opts {
+		o(optCopy)
+	}
+	return optCopy
+}
+
+type Option func(*options)
+
+// StateChangeFunc is called every time the breaker of a service changes its state.
+type StateChangeFunc func(service string, from State, to State)
+
+// WithResponseDiscarder is a function option that decides which responses count as failures of the service.
+//
+// It takes the same `http_retry.ResponseDiscarderFunc` as `http_retry` and `http_failover`. Errors returned by the next
+// RoundTripper always count as failures, unless the request was cancelled by the caller.
+func WithResponseDiscarder(f http_retry.ResponseDiscarderFunc) Option {
+	return func(o *options) {
+		o.discarder = f
+	}
+}
+
+// WithConsecutiveFailures sets the number of consecutive failures after which the breaker trips open.
+//
+// By default it is 5, setting it to 0 disables this threshold.
+func WithConsecutiveFailures(failures uint) Option {
+	return func(o *options) {
+		o.consecutiveFailures = failures
+	}
+}
+
+// WithFailureRatio sets the ratio of failed requests within a time window after which the breaker trips open.
+//
+// The ratio is checked on every failure, once there were at least minRequests in the window, so that a couple of failures of a
+// rarely called service don't trip it. By default the breaker trips at a ratio of 0.5 of at least 20 requests within
+// 10 seconds. Setting the ratio to 0 disables this threshold.
+func WithFailureRatio(ratio float64, minRequests uint, window time.Duration) Option {
+	return func(o *options) {
+		o.failureRatio = ratio
+		o.minRequests = minRequests
+		o.window = window
+	}
+}
+
+// WithOpenTimeout sets the time for which the breaker stays open, before letting probe requests through.
+//
+// By default it is 30 seconds.
+func WithOpenTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.openTimeout = timeout
+	}
+}
+
+// WithHalfOpenRequests sets the number of successful probe requests needed for the breaker to close again.
+//
+// The same number of probe requests is allowed in flight at once while half-open. By default it is 1, and values below
+// 1 are treated as 1, as without probes the breaker would never close again.
+func WithHalfOpenRequests(requests uint) Option {
+	return func(o *options) {
+		if requests < 1 {
+			requests = 1
+		}
+		o.halfOpenRequests = requests
+	}
+}
+
+// WithStateChangeCallback sets a function that is called on every state change of a breaker.
+//
+// The callback is called synchronously on the request path, so it should return quickly.
+func WithStateChangeCallback(f StateChangeFunc) Option {
+	return func(o *options) {
+		o.stateChangeCallback = f
+	}
+}
+
+// DefaultResponseDiscarder is the default implementation of the discarder, treating all 5xx as failures.
+func DefaultResponseDiscarder(resp *http.Response) bool {
+	return resp.StatusCode >= 500
+}
@@ -0,0 +1,92 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_breaker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/internal"
+	"github.com/mwitkow/go-httpwares/tags"
+)
+
+const (
+	// TagForBreakerState is a string naming the ctxtag with the state of the breaker when the request was made.
+	TagForBreakerState = "http.breaker.state"
+)
+
+// OpenError is returned by the Tripperware for requests to a service whose breaker is open.
+type OpenError struct {
+	// Service is the name of the service (or the host) the breaker is kept for.
+	Service string
+	// State is the state of the breaker, either open or half-open with all probe requests in flight.
+	State State
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("http_breaker: circuit breaker for %v is %v", e.Service, e.State)
+}
+
+// IsOpenError checks whether the error, possibly returned from `http.Client`, is caused by an open breaker.
+func IsOpenError(err error) bool {
+	_, ok := http_internal.UnwrapURLError(err).(*OpenError)
+	return ok
+}
+
+// Tripperware is client side HTTP ware that keeps a circuit breaker for every service called.
+//
+// It needs to be placed after `http_ctxtags.Tripperware` in the chain for the breakers to be kept by service name.
+func Tripperware(opts ...Option) httpwares.Tripperware {
+	o := evaluateOptions(opts)
+	return func(next http.RoundTripper) http.RoundTripper {
+		b := &breakers{opts: o, circuits: make(map[string]*circuit)}
+		return httpwares.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			service := http_ctxtags.ServiceName(req)
+			c := b.circuit(service)
+			state, generation, allowed, t := c.allow(time.Now())
+			b.notify(service, t)
+			http_ctxtags.ExtractOutbound(req).Set(TagForBreakerState, state.String())
+			if !allowed {
+				return nil, &OpenError{Service: service, State: state}
+			}
+			resp, err := next.RoundTrip(req)
+			result := outcomeSuccess
+			if err == context.Canceled || req.Context().Err() == context.Canceled {
+				result = outcomeIgnored // the caller gave up, it says nothing about the service.
+			} else if err != nil || o.discarder(resp) {
+				result = outcomeFailure
+			}
+			b.notify(service, c.record(generation, result, time.Now()))
+			return resp, err
+		})
+	}
+}
+
+type breakers struct {
+	opts *options
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+func (b *breakers) circuit(service string) *circuit {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.circuits[service]
+	if !ok {
+		c = &circuit{opts: b.opts, windowStart: time.Now()}
+		b.circuits[service] = c
+	}
+	return c
+}
+
+func (b *breakers) notify(service string, t *transition) {
+	if t != nil && b.opts.stateChangeCallback != nil {
+		b.opts.stateChangeCallback(service, t.from, t.to)
+	}
+}
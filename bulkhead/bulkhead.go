@@ -0,0 +1,152 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_bulkhead
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Bulkhead keeps the compartments limiting the concurrent requests to services and hosts.
+//
+// A single Bulkhead is meant to be shared between Tripperwares, and is safe for concurrent use.
+type Bulkhead struct {
+	opts *options
+
+	mu       sync.Mutex
+	services map[string]*compartment
+	hosts    map[string]*compartment
+}
+
+// Stats is a snapshot of the state of a single compartment, meant for metrics.
+type Stats struct {
+	// InFlight is the number of requests in flight.
+	InFlight int
+	// Queued is the number of requests waiting for a free slot.
+	Queued int
+	// Rejected is the total number of requests rejected, either because the queue was full or because they timed out.
+	Rejected uint64
+}
+
+// NewBulkhead creates a new Bulkhead with the given limits.
+func NewBulkhead(opts ...Option) *Bulkhead {
+	return &Bulkhead{
+		opts:     evaluateOptions(opts),
+		services: make(map[string]*compartment),
+		hosts:    make(map[string]*compartment),
+	}
+}
+
+// Stats returns a snapshot of the compartments of each of the services seen so far.
+func (b *Bulkhead) Stats() map[string]Stats {
+	return b.stats(b.services)
+}
+
+// HostStats returns a snapshot of the compartments of each of the hosts seen so far.
+func (b *Bulkhead) HostStats() map[string]Stats {
+	return b.stats(b.hosts)
+}
+
+func (b *Bulkhead) stats(compartments map[string]*compartment) map[string]Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ret := make(map[string]Stats, len(compartments))
+	for name, c := range compartments {
+		ret[name] = c.stats()
+	}
+	return ret
+}
+
+func (b *Bulkhead) compartment(compartments map[string]*compartment, name string, max int) *compartment {
+	if max <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := compartments[name]
+	if !ok {
+		c = &compartment{max: max, queueSize: b.opts.queueSize}
+		compartments[name] = c
+	}
+	return c
+}
+
+// compartment limits the requests in flight, handing the slots over to queued requests in order.
+type compartment struct {
+	max       int
+	queueSize int
+
+	mu       sync.Mutex
+	inFlight int
+	waiters  []chan struct{}
+	rejected uint64
+}
+
+// acquire takes a slot, returning whether the request was rejected, or the error of its context.
+func (c *compartment) acquire(ctx context.Context, timeout time.Duration) (rejected bool, err error) {
+	c.mu.Lock()
+	if c.inFlight < c.max && len(c.waiters) == 0 {
+		c.inFlight++
+		c.mu.Unlock()
+		return false, nil
+	}
+	if len(c.waiters) >= c.queueSize {
+		c.rejected++
+		c.mu.Unlock()
+		return true, nil
+	}
+	ready := make(chan struct{})
+	c.waiters = append(c.waiters, ready)
+	c.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-ready:
+		return false, nil
+	case <-timer.C:
+		rejected = true
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, w := range c.waiters {
+		if w == ready {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			if rejected {
+				c.rejected++
+			}
+			return rejected, err
+		}
+	}
+	// The slot was handed over just as we gave up, pass it on.
+	c.releaseLocked()
+	if rejected {
+		c.rejected++
+	}
+	return rejected, err
+}
+
+func (c *compartment) release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.releaseLocked()
+}
+
+func (c *compartment) releaseLocked() {
+	if len(c.waiters) > 0 {
+		close(c.waiters[0]) // the slot is handed over, so the number in flight stays the same.
+		c.waiters = c.waiters[1:]
+		return
+	}
+	c.inFlight--
+}
+
+func (c *compartment) stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Stats{InFlight: c.inFlight, Queued: len(c.waiters), Rejected: c.rejected}
+}
@@ -0,0 +1,125 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_bulkhead_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/bulkhead"
+	"github.com/mwitkow/go-httpwares/tags"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingTransport is a fake RoundTripper that holds requests until released.
+type blockingTransport struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingTransport() *blockingTransport {
+	return &blockingTransport{started: make(chan struct{}, 100), release: make(chan struct{})}
+}
+
+func (b *blockingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b.started <- struct{}{}
+	<-b.release
+	return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("")), Request: req}, nil
+}
+
+func bulkheadClient(transport http.RoundTripper, b *http_bulkhead.Bulkhead) *http.Client {
+	return httpwares.TripperwareChain{
+		http_ctxtags.Tripperware(http_ctxtags.WithServiceName("slow")),
+		http_bulkhead.Tripperware(b),
+	}.WrapClient(&http.Client{Transport: transport})
+}
+
+func get(client *http.Client) error {
+	req, _ := http.NewRequest("GET", "http://something.local/someurl", nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// startRequests starts the given number of requests in the background, waiting until they are in flight.
+func startRequests(t *testing.T, client *http.Client, transport *blockingTransport, count int) *sync.WaitGroup {
+	wg := &sync.WaitGroup{}
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, get(client), "requests within the limit must succeed")
+		}()
+		<-transport.started
+	}
+	return wg
+}
+
+func TestBulkheadRejectsOverLimit(t *testing.T) {
+	transport := newBlockingTransport()
+	b := http_bulkhead.NewBulkhead(http_bulkhead.WithMaxPerService(2))
+	client := bulkheadClient(transport, b)
+	wg := startRequests(t, client, transport, 2)
+
+	err := get(client)
+	require.Error(t, err, "requests over the limit must be rejected")
+	assert.True(t, http_bulkhead.IsRejectedError(err), "the error must be typed, got %v", err)
+	assert.Equal(t, http_bulkhead.Stats{InFlight: 2, Rejected: 1}, b.Stats()["slow"], "the stats must be kept by service")
+
+	close(transport.release)
+	wg.Wait()
+	assert.Equal(t, 0, b.Stats()["slow"].InFlight, "slots must be released once bodies are closed")
+}
+
+func TestBulkheadLimitsPerHost(t *testing.T) {
+	transport := newBlockingTransport()
+	b := http_bulkhead.NewBulkhead(http_bulkhead.WithMaxPerService(0), http_bulkhead.WithMaxPerHost(1))
+	client := bulkheadClient(transport, b)
+	wg := startRequests(t, client, transport, 1)
+	assert.True(t, http_bulkhead.IsRejectedError(get(client)), "requests over the host limit must be rejected")
+	assert.Equal(t, 1, b.HostStats()["something.local"].InFlight, "the stats must be kept by host")
+	close(transport.release)
+	wg.Wait()
+}
+
+func TestBulkheadQueuesRequests(t *testing.T) {
+	transport := newBlockingTransport()
+	b := http_bulkhead.NewBulkhead(http_bulkhead.WithMaxPerService(1), http_bulkhead.WithQueue(1, time.Second))
+	client := bulkheadClient(transport, b)
+	wg := startRequests(t, client, transport, 1)
+
+	queued := make(chan error)
+	go func() {
+		queued <- get(client)
+	}()
+	for b.Stats()["slow"].Queued == 0 {
+		time.Sleep(time.Millisecond) // wait for the request to be queued.
+	}
+	assert.True(t, http_bulkhead.IsRejectedError(get(client)), "requests over the queue size must be rejected")
+
+	transport.release <- struct{}{} // finishes the request in flight, handing over its slot.
+	<-transport.started
+	close(transport.release)
+	assert.NoError(t, <-queued, "the queued request must succeed")
+	wg.Wait()
+}
+
+func TestBulkheadQueueTimesOut(t *testing.T) {
+	transport := newBlockingTransport()
+	b := http_bulkhead.NewBulkhead(http_bulkhead.WithMaxPerService(1), http_bulkhead.WithQueue(1, 20*time.Millisecond))
+	client := bulkheadClient(transport, b)
+	wg := startRequests(t, client, transport, 1)
+	assert.True(t, http_bulkhead.IsRejectedError(get(client)), "queued requests must time out")
+	assert.Equal(t, http_bulkhead.Stats{InFlight: 1, Rejected: 1}, b.Stats()["slow"], "timed out requests must leave the queue")
+	close(transport.release)
+	wg.Wait()
+}
@@ -0,0 +1,19 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+/*
+`http_bulkhead` is a HTTP client-side Tripperware that caps the number of concurrent requests to each dependency.
+
+Without a cap, a single slow dependency can use up all goroutines and connections of a client. A `Bulkhead` keeps
+compartments for every service (identified by the `http.call.service` tag set by `http_ctxtags.Tripperware`) and every
+host, limiting the requests in flight in each of them, see `WithMaxPerService` and `WithMaxPerHost`. A request stays in
+flight until its response body is closed.
+
+Requests over the limit are rejected straight away with a `*RejectedError`, unless a wait queue is configured with
+`WithQueue`. Queued requests wait for a free slot for at most the queue timeout, and requests that don't fit in the
+queue are rejected.
+
+The number of requests in flight, queued and rejected in every compartment can be read with `Bulkhead.Stats`, e.g.
+for metrics.
+*/
+package http_bulkhead
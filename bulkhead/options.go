@@ -0,0 +1,61 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_bulkhead
+
+import (
+	"time"
+)
+
+var (
+	defaultOptions = &options{
+		maxPerService: 100,
+	}
+)
+
+type options struct {
+	maxPerService int
+	maxPerHost    int
+	queueSize     int
+	queueTimeout  time.Duration
+}
+
+func evaluateOptions(opts []Option) *options {
+	optCopy := &options{}
+	*optCopy = *defaultOptions
+	for _, o := range opts {
+		o(optCopy)
+	}
+	return optCopy
+}
+
+type Option func(*options)
+
+// WithMaxPerService sets the maximum number of requests in flight to each service.
+//
+// By default it is 100, setting it to 0 disables the limit.
+func WithMaxPerService(max int) Option {
+	return func(o *options) {
+		o.maxPerService = max
+	}
+}
+
+// WithMaxPerHost sets the maximum number of requests in flight to each host.
+//
+// By default there is no limit per host.
+func WithMaxPerHost(max int) Option {
+	return func(o *options) {
+		o.maxPerHost = max
+	}
+}
+
+// WithQueue makes requests over the limit wait for a free slot, instead of being rejected straight away.
+//
+// At most size requests wait in each compartment, for at most the timeout, or until their context is done. By default
+// there is no queue.
+func WithQueue(size int, timeout time.Duration) Option {
+	return func(o *options) {
+		o.queueSize = size
+		o.queueTimeout = timeout
+	}
+}
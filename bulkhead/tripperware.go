@@ -0,0 +1,92 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_bulkhead
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/internal"
+	"github.com/mwitkow/go-httpwares/tags"
+)
+
+const (
+	// TagForBulkheadWait is a string naming the ctxtag with the time in milliseconds a request was queued for.
+	TagForBulkheadWait = "http.bulkhead.wait_ms"
+)
+
+// RejectedError is returned by the Tripperware for requests that didn't get a slot in a compartment.
+type RejectedError struct {
+	// Compartment is either "service" or "host".
+	Compartment string
+	// Name is the name of the service or the host.
+	Name string
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("http_bulkhead: too many requests in flight to %v %v", e.Compartment, e.Name)
+}
+
+// IsRejectedError checks whether the error, possibly returned from `http.Client`, is caused by the bulkhead.
+func IsRejectedError(err error) bool {
+	_, ok := http_internal.UnwrapURLError(err).(*RejectedError)
+	return ok
+}
+
+// Tripperware is client side HTTP ware that limits the concurrent requests to each service and host.
+//
+// It needs to be placed after `http_ctxtags.Tripperware` in the chain for the compartments to be kept by service name.
+func Tripperware(b *Bulkhead) httpwares.Tripperware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return httpwares.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			startTime := time.Now()
+			serviceName := http_ctxtags.ServiceName(req)
+			service := b.compartment(b.services, serviceName, b.opts.maxPerService)
+			if err := b.acquire(service, req, "service", serviceName); err != nil {
+				return nil, err
+			}
+			host := b.compartment(b.hosts, req.URL.Host, b.opts.maxPerHost)
+			if err := b.acquire(host, req, "host", req.URL.Host); err != nil {
+				release(service)
+				return nil, err
+			}
+			if time.Since(startTime) > time.Millisecond {
+				http_ctxtags.ExtractOutbound(req).Set(TagForBulkheadWait, http_internal.TimeDiffToMilliseconds(startTime))
+			}
+			resp, err := next.RoundTrip(req)
+			if resp == nil || resp.Body == nil {
+				release(service)
+				release(host)
+				return resp, err
+			}
+			resp.Body = http_internal.ReleaseOnCloseBody(resp.Body, func() {
+				release(service)
+				release(host)
+			})
+			return resp, err
+		})
+	}
+}
+
+func (b *Bulkhead) acquire(c *compartment, req *http.Request, compartmentType string, name string) error {
+	if c == nil {
+		return nil
+	}
+	rejected, err := c.acquire(req.Context(), b.opts.queueTimeout)
+	if err != nil {
+		return err
+	}
+	if rejected {
+		return &RejectedError{Compartment: compartmentType, Name: name}
+	}
+	return nil
+}
+
+func release(c *compartment) {
+	if c != nil {
+		c.release()
+	}
+}
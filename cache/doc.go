@@ -0,0 +1,29 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+/*
+`http_cache` is a HTTP client-side Tripperware that caches responses, following the rules of RFC 7234.
+
+The cache is private, i.e. meant for a single client, and implements a subset of the RFC. Only responses to GET
+requests are stored, and only if they have a `Cache-Control: max-age`, an `Expires`, an `ETag` or a `Last-Modified`
+header. The `no-store`, `no-cache`, `max-age` and `must-revalidate` directives of responses are obeyed, as well as the
+`no-store`, `no-cache`, `max-age`, `min-fresh`, `max-stale` and `only-if-cached` directives of requests. Responses are
+stored by URL, and are used only for requests with the same values of the headers named in their `Vary` header.
+
+Stale responses with an `ETag` or `Last-Modified` header are revalidated with `If-None-Match` and `If-Modified-Since`
+conditional requests, and used again if the server responds with 304. Successful unsafe requests (e.g. POST, PUT or
+DELETE) to a URL invalidate its stored response, and the ones of the `Location` and `Content-Location` URLs of their
+response on the same host. Requests that are conditional themselves, or ask for a `Range`, are
+passed through.
+
+Storage
+
+The responses are kept in a `Store`. `MemoryStore` keeps them in memory, evicting the least recently used ones over a
+given size, and `DiskStore` keeps them in files of a directory, surviving restarts. Responses with bodies larger than
+`WithMaxEntrySize` are not buffered nor stored.
+
+The outcome of every cached request is recorded in the `http.cache` outbound ctxtag, as either `hit`, `miss` or
+`revalidated`. Place `http_logrus.Tripperware` or `http_debug.Tripperware` before this Tripperware in the chain to
+report it.
+*/
+package http_cache
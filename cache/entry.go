@@ -0,0 +1,111 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mwitkow/go-httpwares/internal"
+)
+
+// entry is a stored response, along with what is needed to decide whether it can be used.
+type entry struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// VaryHeaders are the values of the request headers named in the `Vary` header of the response.
+	VaryHeaders  http.Header
+	RequestTime  time.Time
+	ResponseTime time.Time
+}
+
+func newEntry(req *http.Request, resp *http.Response, body []byte, requestTime time.Time, responseTime time.Time) *entry {
+	e := &entry{
+		StatusCode:   resp.StatusCode,
+		Header:       http_internal.CloneHeader(resp.Header),
+		Body:         body,
+		VaryHeaders:  make(http.Header),
+		RequestTime:  requestTime,
+		ResponseTime: responseTime,
+	}
+	for _, name := range varyHeaderNames(resp.Header) {
+		e.VaryHeaders[name] = req.Header[name]
+	}
+	return e
+}
+
+func decodeEntry(value []byte) (*entry, error) {
+	e := &entry{}
+	if err := gob.NewDecoder(bytes.NewReader(value)).Decode(e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *entry) encode() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(e); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// matches checks whether the request has the same values of the headers the stored response varies by.
+func (e *entry) matches(req *http.Request) bool {
+	for _, name := range varyHeaderNames(e.Header) {
+		if strings.Join(req.Header[name], ",") != strings.Join(e.VaryHeaders[name], ",") {
+			return false
+		}
+	}
+	return true
+}
+
+// revalidated updates the stored response with the headers of a 304 response to a conditional request.
+//
+// See https://tools.ietf.org/html/rfc7234#section-4.3.4
+func (e *entry) revalidated(resp *http.Response, requestTime time.Time, responseTime time.Time) {
+	for name, values := range resp.Header {
+		if name == "Content-Length" || name == "Transfer-Encoding" {
+			continue
+		}
+		e.Header[name] = values
+	}
+	e.RequestTime = requestTime
+	e.ResponseTime = responseTime
+}
+
+// response returns a new response to the request, made from the stored one.
+func (e *entry) response(req *http.Request, now time.Time) *http.Response {
+	header := http_internal.CloneHeader(e.Header)
+	header.Set("Age", fmt.Sprintf("%d", int64(e.currentAge(now).Seconds())))
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+func varyHeaderNames(header http.Header) []string {
+	var names []string
+	for _, line := range header["Vary"] {
+		for _, name := range strings.Split(line, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,162 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_cache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheableStatusCodes are the status codes of responses that can be stored.
+//
+// See https://tools.ietf.org/html/rfc7231#section-6.1
+var cacheableStatusCodes = map[int]bool{
+	200: true, 203: true, 204: true, 300: true, 301: true, 404: true, 405: true, 410: true, 414: true, 501: true,
+}
+
+// cacheControl holds the directives of `Cache-Control` headers.
+type cacheControl map[string]string
+
+func parseCacheControl(header http.Header) cacheControl {
+	cc := cacheControl{}
+	for _, line := range header["Cache-Control"] {
+		for _, directive := range strings.Split(line, ",") {
+			directive = strings.TrimSpace(directive)
+			if directive == "" {
+				continue
+			}
+			if i := strings.Index(directive, "="); i >= 0 {
+				cc[strings.ToLower(strings.TrimSpace(directive[:i]))] = strings.Trim(strings.TrimSpace(directive[i+1:]), `"`)
+			} else {
+				cc[strings.ToLower(directive)] = ""
+			}
+		}
+	}
+	return cc
+}
+
+// requestCacheControl returns the directives of the request, treating `Pragma: no-cache` as `no-cache`.
+//
+// See https://tools.ietf.org/html/rfc7234#section-5.4
+func requestCacheControl(req *http.Request) cacheControl {
+	cc := parseCacheControl(req.Header)
+	if _, ok := req.Header["Cache-Control"]; !ok && strings.Contains(req.Header.Get("Pragma"), "no-cache") {
+		cc["no-cache"] = ""
+	}
+	return cc
+}
+
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
+
+// seconds returns the value of a directive given in delta-seconds.
+func (cc cacheControl) seconds(directive string) (time.Duration, bool) {
+	value, ok := cc[directive]
+	if !ok {
+		return 0, false
+	}
+	return parseDeltaSeconds(value)
+}
+
+func parseDeltaSeconds(value string) (time.Duration, bool) {
+	seconds, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// isCacheable checks whether the response to the request can be stored.
+func isCacheable(req *http.Request, resp *http.Response) bool {
+	if req.Method != "GET" || !cacheableStatusCodes[resp.StatusCode] {
+		return false
+	}
+	if requestCacheControl(req).has("no-store") {
+		return false
+	}
+	respCC := parseCacheControl(resp.Header)
+	if respCC.has("no-store") || strings.TrimSpace(resp.Header.Get("Vary")) == "*" {
+		return false
+	}
+	_, hasMaxAge := respCC.seconds("max-age")
+	return hasMaxAge || resp.Header.Get("Expires") != "" || hasValidators(resp.Header)
+}
+
+func hasValidators(header http.Header) bool {
+	return header.Get("ETag") != "" || header.Get("Last-Modified") != ""
+}
+
+// freshnessLifetime returns the time the response is fresh for after it was generated.
+//
+// See https://tools.ietf.org/html/rfc7234#section-4.2.1
+func freshnessLifetime(header http.Header, responseTime time.Time) time.Duration {
+	cc := parseCacheControl(header)
+	if cc.has("no-cache") {
+		return 0
+	}
+	if maxAge, ok := cc.seconds("max-age"); ok {
+		return maxAge
+	}
+	if expiresValue := header.Get("Expires"); expiresValue != "" {
+		expires, err := http.ParseTime(expiresValue)
+		if err != nil {
+			return 0 // invalid dates mean the response has already expired.
+		}
+		date, err := http.ParseTime(header.Get("Date"))
+		if err != nil {
+			date = responseTime // responses without a date are dated when received, see RFC 7231 section 7.1.1.2.
+		}
+		return expires.Sub(date)
+	}
+	return 0
+}
+
+// currentAge returns the time since the stored response was generated by the server.
+//
+// See https://tools.ietf.org/html/rfc7234#section-4.2.3
+func (e *entry) currentAge(now time.Time) time.Duration {
+	apparentAge := time.Duration(0)
+	if date, err := http.ParseTime(e.Header.Get("Date")); err == nil && e.ResponseTime.After(date) {
+		apparentAge = e.ResponseTime.Sub(date)
+	}
+	correctedAge := e.ResponseTime.Sub(e.RequestTime)
+	if ageValue, ok := parseDeltaSeconds(e.Header.Get("Age")); ok {
+		correctedAge += ageValue
+	}
+	if correctedAge < apparentAge {
+		correctedAge = apparentAge
+	}
+	return correctedAge + now.Sub(e.ResponseTime)
+}
+
+// isFresh checks whether the stored response can be used for the request without revalidating it.
+func (e *entry) isFresh(reqCC cacheControl, now time.Time) bool {
+	if reqCC.has("no-cache") {
+		return false
+	}
+	age := e.currentAge(now)
+	if maxAge, ok := reqCC.seconds("max-age"); ok && age > maxAge {
+		return false
+	}
+	if minFresh, ok := reqCC.seconds("min-fresh"); ok {
+		age += minFresh
+	}
+	lifetime := freshnessLifetime(e.Header, e.ResponseTime)
+	if age < lifetime {
+		return true
+	}
+	if value, ok := reqCC["max-stale"]; ok && !parseCacheControl(e.Header).has("must-revalidate") {
+		if value == "" {
+			return true // any staleness is fine.
+		}
+		if maxStale, ok := reqCC.seconds("max-stale"); ok && age-lifetime <= maxStale {
+			return true
+		}
+	}
+	return false
+}
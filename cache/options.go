@@ -0,0 +1,47 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_cache
+
+import (
+	"time"
+)
+
+var (
+	defaultOptions = &options{
+		clock:        time.Now,
+		maxEntrySize: 1 << 20,
+	}
+)
+
+type options struct {
+	clock        func() time.Time
+	maxEntrySize int64
+}
+
+func evaluateOptions(opts []Option) *options {
+	optCopy := &options{}
+	*optCopy = *defaultOptions
+	for _, o := range opts {
+		o(optCopy)
+	}
+	return optCopy
+}
+
+type Option func(*options)
+
+// WithClock sets the source of time used for the age of stored responses, meant for tests.
+func WithClock(now func() time.Time) Option {
+	return func(o *options) {
+		o.clock = now
+	}
+}
+
+// WithMaxEntrySize sets the size in bytes of the largest response body that is stored, 1MiB by default.
+//
+// Responses with larger bodies are passed through without being buffered or stored.
+func WithMaxEntrySize(maxBytes int64) Option {
+	return func(o *options) {
+		o.maxEntrySize = maxBytes
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Store keeps the encoded responses of the cache by their key.
+//
+// Implementations need to be safe for concurrent use. Failures of the storage are treated as misses.
+type Store interface {
+	// Get returns the value stored under the key.
+	Get(key string) ([]byte, bool)
+	// Set stores the value under the key, replacing the existing one.
+	Set(key string, value []byte)
+	// Delete removes the value stored under the key.
+	Delete(key string)
+}
+
+// MemoryStore is an in-memory Store, evicting the least recently used values once their size exceeds the maximum.
+type MemoryStore struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	values   map[string]*list.Element
+	lru      *list.List
+}
+
+type memoryValue struct {
+	key   string
+	value []byte
+}
+
+// NewMemoryStore creates a new in-memory Store keeping at most maxBytes of values. Values larger than that are not
+// stored at all.
+func NewMemoryStore(maxBytes int64) *MemoryStore {
+	return &MemoryStore{
+		maxBytes: maxBytes,
+		values:   make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// Get implements Store.
+func (s *MemoryStore) Get(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elem, ok := s.values[key]
+	if !ok {
+		return nil, false
+	}
+	s.lru.MoveToFront(elem)
+	return elem.Value.(*memoryValue).value, true
+}
+
+// Set implements Store.
+func (s *MemoryStore) Set(key string, value []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(key)
+	if int64(len(value)) > s.maxBytes {
+		return
+	}
+	s.values[key] = s.lru.PushFront(&memoryValue{key: key, value: value})
+	s.size += int64(len(value))
+	for s.size > s.maxBytes {
+		s.remove(s.lru.Back().Value.(*memoryValue).key)
+	}
+}
+
+// Delete implements Store.
+func (s *MemoryStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(key)
+}
+
+// Size returns the total size of the stored values in bytes.
+func (s *MemoryStore) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+func (s *MemoryStore) remove(key string) {
+	if elem, ok := s.values[key]; ok {
+		s.lru.Remove(elem)
+		delete(s.values, key)
+		s.size -= int64(len(elem.Value.(*memoryValue).value))
+	}
+}
+
+// DiskStore is a Store keeping every value in a file of a directory.
+//
+// The size of the directory is not limited, and the files need to be cleaned up by other means if needed.
+type DiskStore struct {
+	dir string
+}
+
+// NewDiskStore creates a new Store in the given directory, creating it if it doesn't exist.
+func NewDiskStore(dir string) (*DiskStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &DiskStore{dir: dir}, nil
+}
+
+// Get implements Store.
+func (s *DiskStore) Get(key string) ([]byte, bool) {
+	value, err := ioutil.ReadFile(s.path(key))
+	if err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// Set implements Store.
+func (s *DiskStore) Set(key string, value []byte) {
+	// Write to a temporary file first, so that readers never see a partially written value.
+	f, err := ioutil.TempFile(s.dir, "tmp-")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(value)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), s.path(key))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
+
+// Delete implements Store.
+func (s *DiskStore) Delete(key string) {
+	os.Remove(s.path(key))
+}
+
+func (s *DiskStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
@@ -0,0 +1,49 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_cache_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/mwitkow/go-httpwares/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	store := http_cache.NewMemoryStore(10)
+	store.Set("a", []byte("aaaa"))
+	store.Set("b", []byte("bbbb"))
+	_, ok := store.Get("a")
+	require.True(t, ok)
+	store.Set("c", []byte("cccc"))
+	assert.Equal(t, int64(8), store.Size(), "the size must be kept under the maximum")
+	_, ok = store.Get("a")
+	assert.True(t, ok, "recently used values must be kept")
+	_, ok = store.Get("b")
+	assert.False(t, ok, "the least recently used value must be evicted")
+	store.Set("d", []byte("too large value"))
+	_, ok = store.Get("d")
+	assert.False(t, ok, "values over the maximum must not be stored")
+}
+
+func TestDiskStoreKeepsValuesInFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "http_cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store, err := http_cache.NewDiskStore(dir)
+	require.NoError(t, err)
+	store.Set("http://something.local/someurl", []byte("some value"))
+
+	reopened, err := http_cache.NewDiskStore(dir)
+	require.NoError(t, err)
+	value, ok := reopened.Get("http://something.local/someurl")
+	require.True(t, ok, "values must survive reopening the store")
+	assert.Equal(t, "some value", string(value))
+	reopened.Delete("http://something.local/someurl")
+	_, ok = store.Get("http://something.local/someurl")
+	assert.False(t, ok, "deleted values must be gone")
+}
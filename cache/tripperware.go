@@ -0,0 +1,194 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_cache
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/internal"
+	"github.com/mwitkow/go-httpwares/tags"
+)
+
+const (
+	// TagForCache is a string naming the ctxtag with the outcome of a cached request.
+	TagForCache = "http.cache"
+
+	// CacheHit means the stored response was fresh, and was used without making a request.
+	CacheHit = "hit"
+	// CacheMiss means there was no usable stored response, and the request was made.
+	CacheMiss = "miss"
+	// CacheRevalidated means the stored response was stale, and was used after the server confirmed it is still valid.
+	CacheRevalidated = "revalidated"
+)
+
+// conditionalHeaders are the request headers that make the caller handle the validation of responses.
+var conditionalHeaders = []string{"If-None-Match", "If-Modified-Since", "If-Match", "If-Unmodified-Since", "If-Range", "Range"}
+
+// Tripperware is client side HTTP ware that caches responses in the given Store.
+func Tripperware(store Store, opts ...Option) httpwares.Tripperware {
+	o := evaluateOptions(opts)
+	return func(next http.RoundTripper) http.RoundTripper {
+		return httpwares.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			key := req.URL.String()
+			if req.Method != "GET" {
+				resp, err := next.RoundTrip(req)
+				if err == nil && isUnsafe(req.Method) && resp.StatusCode < 400 {
+					invalidate(store, req, resp)
+				}
+				return resp, err
+			}
+			if isConditional(req) {
+				return next.RoundTrip(req)
+			}
+			tags := http_ctxtags.ExtractOutbound(req)
+			reqCC := requestCacheControl(req)
+			cached := loadEntry(store, key, req)
+			if cached != nil && cached.isFresh(reqCC, o.clock()) {
+				tags.Set(TagForCache, CacheHit)
+				return cached.response(req, o.clock()), nil
+			}
+			tags.Set(TagForCache, CacheMiss)
+			if reqCC.has("only-if-cached") {
+				return gatewayTimeout(req), nil
+			}
+			upstreamReq := req
+			if cached != nil && hasValidators(cached.Header) {
+				upstreamReq = conditionalRequest(req, cached)
+			}
+			requestTime := o.clock()
+			resp, err := next.RoundTrip(upstreamReq)
+			if err != nil {
+				return nil, err
+			}
+			responseTime := o.clock()
+			if upstreamReq != req && resp.StatusCode == http.StatusNotModified {
+				io.Copy(ioutil.Discard, resp.Body)
+				resp.Body.Close()
+				cached.revalidated(resp, requestTime, responseTime)
+				storeEntry(store, key, cached)
+				tags.Set(TagForCache, CacheRevalidated)
+				return cached.response(req, responseTime), nil
+			}
+			if isCacheable(req, resp) {
+				resp.Body = &storingBody{ReadCloser: resp.Body, maxBytes: o.maxEntrySize, onEOF: func(body []byte) {
+					storeEntry(store, key, newEntry(req, resp, body, requestTime, responseTime))
+				}}
+			}
+			return resp, nil
+		})
+	}
+}
+
+// loadEntry returns the stored response for the request, or nil if there is none that could be used for it.
+func loadEntry(store Store, key string, req *http.Request) *entry {
+	value, ok := store.Get(key)
+	if !ok {
+		return nil
+	}
+	e, err := decodeEntry(value)
+	if err != nil || !e.matches(req) {
+		return nil
+	}
+	return e
+}
+
+// invalidate deletes the stored responses made invalid by the successful unsafe request.
+//
+// These are the ones of the request URL, and of the `Location` and `Content-Location` URLs of the response if they have
+// the same host, see https://tools.ietf.org/html/rfc7234#section-4.4
+func invalidate(store Store, req *http.Request, resp *http.Response) {
+	store.Delete(req.URL.String())
+	for _, name := range []string{"Location", "Content-Location"} {
+		value := resp.Header.Get(name)
+		if value == "" {
+			continue
+		}
+		u, err := req.URL.Parse(value)
+		if err != nil || u.Host != req.URL.Host {
+			continue // invalidating other hosts would allow denial of service attacks.
+		}
+		store.Delete(u.String())
+	}
+}
+
+func storeEntry(store Store, key string, e *entry) {
+	if value, err := e.encode(); err == nil {
+		store.Set(key, value)
+	}
+}
+
+// conditionalRequest returns a copy of the request that validates the stored response.
+func conditionalRequest(req *http.Request, cached *entry) *http.Request {
+	condReq := req.WithContext(req.Context()) // make a copy.
+	condReq.Header = http_internal.CloneHeader(req.Header)
+	if etag := cached.Header.Get("ETag"); etag != "" {
+		condReq.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := cached.Header.Get("Last-Modified"); lastModified != "" {
+		condReq.Header.Set("If-Modified-Since", lastModified)
+	}
+	return condReq
+}
+
+// gatewayTimeout returns the response to `only-if-cached` requests that have no stored response.
+//
+// See https://tools.ietf.org/html/rfc7234#section-5.2.1.7
+func gatewayTimeout(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:     "504 Gateway Timeout",
+		StatusCode: http.StatusGatewayTimeout,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}
+}
+
+func isConditional(req *http.Request) bool {
+	for _, name := range conditionalHeaders {
+		if req.Header.Get(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func isUnsafe(method string) bool {
+	return method != "HEAD" && method != "OPTIONS" && method != "TRACE"
+}
+
+// storingBody passes the response body through, and hands it over once it was read whole.
+//
+// Bodies larger than maxBytes are only passed through, and not handed over.
+type storingBody struct {
+	io.ReadCloser
+	buf      bytes.Buffer
+	maxBytes int64
+	onEOF    func(body []byte)
+}
+
+func (b *storingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if b.onEOF == nil {
+		return n, err
+	}
+	if int64(b.buf.Len()+n) > b.maxBytes {
+		b.onEOF = nil // too large to store, stop buffering.
+		b.buf = bytes.Buffer{}
+		return n, err
+	}
+	b.buf.Write(p[:n])
+	if err == io.EOF {
+		b.onEOF(b.buf.Bytes())
+		b.onEOF = nil
+	}
+	return n, err
+}
@@ -0,0 +1,235 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_cache_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/cache"
+	"github.com/mwitkow/go-httpwares/tags"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeServer responds with the response set for the method, recording the requests it got.
+type fakeServer struct {
+	now       time.Time
+	requests  []*http.Request
+	responses map[string]func(req *http.Request) (int, http.Header, string)
+}
+
+func newFakeServer() *fakeServer {
+	return &fakeServer{now: time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC), responses: make(map[string]func(*http.Request) (int, http.Header, string))}
+}
+
+func (s *fakeServer) Now() time.Time {
+	return s.now
+}
+
+func (s *fakeServer) RoundTrip(req *http.Request) (*http.Response, error) {
+	s.requests = append(s.requests, req)
+	code, header, body := s.responses[req.Method](req)
+	header.Set("Date", s.now.Format(http.TimeFormat))
+	return &http.Response{StatusCode: code, Header: header, Body: ioutil.NopCloser(strings.NewReader(body)), Request: req}, nil
+}
+
+func (s *fakeServer) respond(method string, code int, header http.Header, body string) {
+	s.responses[method] = func(*http.Request) (int, http.Header, string) {
+		return code, cloneHeader(header), body
+	}
+}
+
+func cloneHeader(h http.Header) http.Header {
+	h2 := make(http.Header)
+	for k, v := range h {
+		h2[k] = v
+	}
+	return h2
+}
+
+type result struct {
+	resp *http.Response
+	body string
+	tag  interface{}
+}
+
+func (s *fakeServer) do(t *testing.T, client *http.Client, method string, header http.Header) *result {
+	req, _ := http.NewRequest(method, "http://something.local/someurl", nil)
+	if header != nil {
+		req.Header = header
+	}
+	tags := http_ctxtags.ExtractOutbound(req)
+	req = http_ctxtags.SetOutboundInRequest(req, tags)
+	resp, err := client.Do(req)
+	require.NoError(t, err, "call shouldn't fail")
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	return &result{resp: resp, body: string(body), tag: tags.Values()[http_cache.TagForCache]}
+}
+
+func cachingClient(server *fakeServer, opts ...http_cache.Option) *http.Client {
+	opts = append(opts, http_cache.WithClock(server.Now))
+	return httpwares.TripperwareChain{
+		http_ctxtags.Tripperware(),
+		http_cache.Tripperware(http_cache.NewMemoryStore(1<<20), opts...),
+	}.WrapClient(&http.Client{Transport: server})
+}
+
+func TestTripperwareServesFreshResponses(t *testing.T) {
+	server := newFakeServer()
+	server.respond("GET", http.StatusOK, http.Header{"Cache-Control": []string{"max-age=60"}}, "some response")
+	client := cachingClient(server)
+	res := server.do(t, client, "GET", nil)
+	assert.Equal(t, http_cache.CacheMiss, res.tag, "the first request must miss")
+	server.now = server.now.Add(30 * time.Second)
+	res = server.do(t, client, "GET", nil)
+	assert.Equal(t, http_cache.CacheHit, res.tag, "fresh responses must be hits")
+	assert.Equal(t, http.StatusOK, res.resp.StatusCode)
+	assert.Equal(t, "some response", res.body, "the stored body must be served")
+	assert.Equal(t, "30", res.resp.Header.Get("Age"), "the age of the stored response must be sent")
+	assert.Len(t, server.requests, 1, "fresh responses must not be requested again")
+
+	server.now = server.now.Add(31 * time.Second)
+	res = server.do(t, client, "GET", nil)
+	assert.Equal(t, http_cache.CacheMiss, res.tag, "stale responses without validators must be requested again")
+	assert.Len(t, server.requests, 2)
+}
+
+func TestTripperwareHonoursExpires(t *testing.T) {
+	server := newFakeServer()
+	expires := server.now.Add(time.Minute).Format(http.TimeFormat)
+	server.respond("GET", http.StatusOK, http.Header{"Expires": []string{expires}}, "some response")
+	client := cachingClient(server)
+	server.do(t, client, "GET", nil)
+	server.now = server.now.Add(59 * time.Second)
+	assert.Equal(t, http_cache.CacheHit, server.do(t, client, "GET", nil).tag, "responses must be fresh until they expire")
+	server.now = server.now.Add(time.Second)
+	assert.Equal(t, http_cache.CacheMiss, server.do(t, client, "GET", nil).tag, "expired responses must be stale")
+}
+
+func TestTripperwareHonoursExpiresWithoutDate(t *testing.T) {
+	server := newFakeServer()
+	expires := server.now.Add(time.Minute).Format(http.TimeFormat)
+	server.respond("GET", http.StatusOK, http.Header{"Expires": []string{expires}}, "some response")
+	transport := httpwares.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		resp, err := server.RoundTrip(req)
+		resp.Header.Del("Date")
+		return resp, err
+	})
+	client := httpwares.TripperwareChain{
+		http_ctxtags.Tripperware(),
+		http_cache.Tripperware(http_cache.NewMemoryStore(1<<20), http_cache.WithClock(server.Now)),
+	}.WrapClient(&http.Client{Transport: transport})
+	server.do(t, client, "GET", nil)
+	server.now = server.now.Add(59 * time.Second)
+	assert.Equal(t, http_cache.CacheHit, server.do(t, client, "GET", nil).tag, "responses without a date must be fresh until they expire")
+	server.now = server.now.Add(time.Second)
+	assert.Equal(t, http_cache.CacheMiss, server.do(t, client, "GET", nil).tag, "expired responses must be stale")
+}
+
+func TestTripperwareRevalidatesStaleResponses(t *testing.T) {
+	server := newFakeServer()
+	server.respond("GET", http.StatusOK, http.Header{"Cache-Control": []string{"max-age=10"}, "Etag": []string{`"v1"`}}, "some response")
+	client := cachingClient(server)
+	server.do(t, client, "GET", nil)
+
+	server.now = server.now.Add(20 * time.Second)
+	server.responses["GET"] = func(req *http.Request) (int, http.Header, string) {
+		if req.Header.Get("If-None-Match") == `"v1"` {
+			return http.StatusNotModified, http.Header{"Cache-Control": []string{"max-age=10"}}, ""
+		}
+		return http.StatusOK, http.Header{}, "other response"
+	}
+	res := server.do(t, client, "GET", nil)
+	require.Len(t, server.requests, 2, "stale responses must be revalidated")
+	assert.Equal(t, `"v1"`, server.requests[1].Header.Get("If-None-Match"), "the revalidation must be conditional")
+	assert.Equal(t, http_cache.CacheRevalidated, res.tag, "revalidated responses must be tagged")
+	assert.Equal(t, http.StatusOK, res.resp.StatusCode, "the stored response must be served, not the 304")
+	assert.Equal(t, "some response", res.body, "the stored body must be served")
+
+	server.now = server.now.Add(5 * time.Second)
+	assert.Equal(t, http_cache.CacheHit, server.do(t, client, "GET", nil).tag, "revalidated responses must be fresh again")
+	assert.Len(t, server.requests, 2)
+}
+
+func TestTripperwareObeysRequestDirectives(t *testing.T) {
+	server := newFakeServer()
+	server.respond("GET", http.StatusOK, http.Header{"Cache-Control": []string{"max-age=60"}}, "some response")
+	client := cachingClient(server)
+	res := server.do(t, client, "GET", http.Header{"Cache-Control": []string{"only-if-cached"}})
+	assert.Equal(t, http.StatusGatewayTimeout, res.resp.StatusCode, "only-if-cached requests without a stored response must fail")
+	assert.Len(t, server.requests, 0, "only-if-cached requests must not be sent")
+
+	server.do(t, client, "GET", nil)
+	server.now = server.now.Add(30 * time.Second)
+	assert.Equal(t, http_cache.CacheMiss, server.do(t, client, "GET", http.Header{"Cache-Control": []string{"max-age=10"}}).tag, "responses older than the max-age of the request must not be served")
+	assert.Equal(t, http_cache.CacheMiss, server.do(t, client, "GET", http.Header{"Cache-Control": []string{"no-cache"}}).tag, "no-cache requests must not be served from the cache")
+	server.now = server.now.Add(90 * time.Second)
+	assert.Equal(t, http_cache.CacheHit, server.do(t, client, "GET", http.Header{"Cache-Control": []string{"max-stale=120"}}).tag, "stale responses must be served within max-stale")
+}
+
+func TestTripperwareDoesNotStoreNoStoreResponses(t *testing.T) {
+	server := newFakeServer()
+	server.respond("GET", http.StatusOK, http.Header{"Cache-Control": []string{"no-store, max-age=60"}}, "some response")
+	client := cachingClient(server)
+	server.do(t, client, "GET", nil)
+	assert.Equal(t, http_cache.CacheMiss, server.do(t, client, "GET", nil).tag, "no-store responses must not be stored")
+	assert.Len(t, server.requests, 2)
+}
+
+func TestTripperwareDoesNotStoreLargeResponses(t *testing.T) {
+	server := newFakeServer()
+	server.respond("GET", http.StatusOK, http.Header{"Cache-Control": []string{"max-age=60"}}, "some response")
+	client := cachingClient(server, http_cache.WithMaxEntrySize(5))
+	assert.Equal(t, "some response", server.do(t, client, "GET", nil).body, "the whole body must be passed through")
+	res := server.do(t, client, "GET", nil)
+	assert.Equal(t, http_cache.CacheMiss, res.tag, "responses over the max entry size must not be stored")
+	assert.Equal(t, "some response", res.body)
+	assert.Len(t, server.requests, 2)
+}
+
+func TestTripperwareVariesByRequestHeaders(t *testing.T) {
+	server := newFakeServer()
+	server.respond("GET", http.StatusOK, http.Header{"Cache-Control": []string{"max-age=60"}, "Vary": []string{"Accept-Language"}}, "some response")
+	client := cachingClient(server)
+	server.do(t, client, "GET", http.Header{"Accept-Language": []string{"en"}})
+	assert.Equal(t, http_cache.CacheHit, server.do(t, client, "GET", http.Header{"Accept-Language": []string{"en"}}).tag, "requests with the same headers must be hits")
+	assert.Equal(t, http_cache.CacheMiss, server.do(t, client, "GET", http.Header{"Accept-Language": []string{"pl"}}).tag, "requests with different varied headers must miss")
+}
+
+func TestTripperwareInvalidatesOnUnsafeRequests(t *testing.T) {
+	server := newFakeServer()
+	server.respond("GET", http.StatusOK, http.Header{"Cache-Control": []string{"max-age=60"}}, "some response")
+	server.respond("POST", http.StatusOK, http.Header{}, "")
+	client := cachingClient(server)
+	server.do(t, client, "GET", nil)
+	server.do(t, client, "POST", nil)
+	assert.Equal(t, http_cache.CacheMiss, server.do(t, client, "GET", nil).tag, "unsafe requests must invalidate the stored response")
+	assert.Len(t, server.requests, 3)
+}
+
+func TestTripperwareInvalidatesLocationsOfUnsafeRequests(t *testing.T) {
+	server := newFakeServer()
+	server.respond("GET", http.StatusOK, http.Header{"Cache-Control": []string{"max-age=60"}}, "some response")
+	server.respond("POST", http.StatusCreated, http.Header{"Location": []string{"/someurl"}}, "")
+	client := cachingClient(server)
+	server.do(t, client, "GET", nil)
+	req, _ := http.NewRequest("POST", "http://something.local/collection", nil)
+	resp, err := client.Do(req)
+	require.NoError(t, err, "call shouldn't fail")
+	resp.Body.Close()
+	assert.Equal(t, http_cache.CacheMiss, server.do(t, client, "GET", nil).tag, "unsafe requests must invalidate the stored response of their Location")
+
+	server.respond("POST", http.StatusOK, http.Header{"Content-Location": []string{"http://other.local/someurl"}}, "")
+	req, _ = http.NewRequest("POST", "http://something.local/collection", nil)
+	resp, err = client.Do(req)
+	require.NoError(t, err, "call shouldn't fail")
+	resp.Body.Close()
+	assert.Equal(t, http_cache.CacheHit, server.do(t, client, "GET", nil).tag, "locations on other hosts must not be invalidated")
+}
@@ -0,0 +1,20 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+/*
+`http_coalesce` is a HTTP client-side Tripperware that merges concurrent identical requests into a single upstream call.
+
+Services fanning out requests often send the same GET to the same backend at the same moment. With this Tripperware,
+while a request is in flight, identical requests wait for its response instead of being sent. Requests are identical if
+they have the same method, URL and values of the key headers (see `WithKeyHeaders`). Range and conditional requests
+are never merged by default, as their responses depend on these headers.
+
+Every caller gets its own copy of the response, with the body buffered in memory. Bodies larger than
+`WithMaxSharedBodySize` are not shared: they are streamed to the request that started the upstream call, and the
+requests that waited for it are sent upstream on their own. The upstream call is not tied to the
+context of the first caller: it carries the first caller's context values (e.g. tracing) and a copy of its tags, but it
+is cancelled only once all of the callers waiting for it are gone. Tags set on the upstream call by later Tripperware are
+copied to every caller once it is done. Requests that shared the response of another one have the
+`http.coalesce.shared` tag set.
+*/
+package http_coalesce
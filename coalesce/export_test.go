@@ -0,0 +1,9 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_coalesce
+
+// SetJoinHook sets a function called every time a request joins a call in flight, so that tests can wait for it.
+func SetJoinHook(f func()) {
+	joinHook = f
+}
@@ -0,0 +1,82 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_coalesce
+
+import (
+	"net/http"
+	"strings"
+)
+
+var (
+	defaultOptions = &options{
+		decider:           DefaultCoalesceDecider,
+		keyHeaders:        []string{"Accept", "Authorization", "Cookie"},
+		maxSharedBodySize: 1 << 20,
+	}
+)
+
+type options struct {
+	decider           RequestCoalesceDeciderFunc
+	keyHeaders        []string
+	maxSharedBodySize int64
+}
+
+func evaluateOptions(opts []Option) *options {
+	optCopy := &options{}
+	*optCopy = *defaultOptions
+	for _, o := range opts {
+		o(optCopy)
+	}
+	return optCopy
+}
+
+type Option func(*options)
+
+// RequestCoalesceDeciderFunc decides whether the given request can be merged with identical ones.
+type RequestCoalesceDeciderFunc func(req *http.Request) bool
+
+// WithDecider is a function that allows users to customize the logic that decides whether a request can be merged.
+func WithDecider(f RequestCoalesceDeciderFunc) Option {
+	return func(o *options) {
+		o.decider = f
+	}
+}
+
+// WithKeyHeaders sets the headers that need to have the same values for requests to be merged.
+//
+// By default these are `Accept`, `Authorization` and `Cookie`, so that responses meant for different callers are never
+// shared. Any header the response depends on, e.g. by `Vary`, needs to be included.
+func WithKeyHeaders(headers ...string) Option {
+	return func(o *options) {
+		o.keyHeaders = headers
+	}
+}
+
+// WithMaxSharedBodySize sets the size in bytes of the largest response body buffered for sharing, 1MiB by default.
+//
+// Larger bodies are streamed to the request that started the upstream call only, while the requests that waited for it
+// are sent upstream on their own.
+func WithMaxSharedBodySize(maxBytes int64) Option {
+	return func(o *options) {
+		o.maxSharedBodySize = maxBytes
+	}
+}
+
+// DefaultCoalesceDecider is the default implementation that merges only GET and HEAD requests without a body.
+//
+// Range and conditional (`If-*`) requests are not merged, as their responses depend on these headers.
+func DefaultCoalesceDecider(req *http.Request) bool {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		return false
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		return false
+	}
+	for name := range req.Header {
+		if name == "Range" || strings.HasPrefix(name, "If-") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,227 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_coalesce
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/internal"
+	"github.com/mwitkow/go-httpwares/tags"
+)
+
+const (
+	// TagForCoalesced is a string naming the ctxtag set on requests that shared the response of another request.
+	TagForCoalesced = "http.coalesce.shared"
+)
+
+// joinHook is called every time a request joins a call in flight, set only in tests.
+var joinHook func()
+
+// Tripperware is client side HTTP ware that merges concurrent identical requests into a single upstream call.
+//
+// By default only GET and HEAD requests are merged, see `WithDecider`.
+func Tripperware(opts ...Option) httpwares.Tripperware {
+	o := evaluateOptions(opts)
+	return func(next http.RoundTripper) http.RoundTripper {
+		g := &group{calls: make(map[string]*call)}
+		return httpwares.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if !o.decider(req) {
+				return next.RoundTrip(req)
+			}
+			key := requestKey(req, o.keyHeaders)
+			c, shared := g.join(next, req, key, o.maxSharedBodySize)
+			if shared && joinHook != nil {
+				joinHook()
+			}
+			select {
+			case <-c.done:
+			case <-req.Context().Done():
+				g.leave(key, c, !shared)
+				return nil, req.Context().Err()
+			}
+			tags := http_ctxtags.ExtractOutbound(req)
+			if c.tooLarge {
+				// The body is only streamed to the first caller, the others send their own requests.
+				if resp := g.claimStream(c, !shared); resp != nil {
+					c.copyTags(tags)
+					resp.Request = req
+					return resp, nil
+				}
+				return next.RoundTrip(req)
+			}
+			if shared {
+				tags.Set(TagForCoalesced, true)
+			}
+			c.copyTags(tags)
+			return c.response(req)
+		})
+	}
+}
+
+// requestKey returns the key under which identical requests are merged.
+func requestKey(req *http.Request, keyHeaders []string) string {
+	parts := []string{req.Method, req.URL.String()}
+	for _, name := range keyHeaders {
+		parts = append(parts, strings.Join(req.Header[http.CanonicalHeaderKey(name)], ","))
+	}
+	return strings.Join(parts, "\n")
+}
+
+// group keeps the upstream calls in flight by their key.
+type group struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+// call is a single upstream call, shared by all the callers waiting for it.
+type call struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int
+	// tags are the outbound tags of the upstream call, only to be read once done is closed.
+	tags *http_ctxtags.Tags
+	// leaderWaiting is true as long as the caller that started the call waits for it.
+	leaderWaiting bool
+	// tooLarge is set if the body is over the size that can be shared, only to be read once done is closed.
+	tooLarge bool
+	// stream is the response with a body too large to share, until claimed by the caller that started the call.
+	stream *http.Response
+
+	resp *http.Response
+	body []byte
+	err  error
+}
+
+// join returns the call in flight for the key, starting a new one if there is none. It returns true if the call was
+// started by another request.
+func (g *group) join(next http.RoundTripper, req *http.Request, key string, maxBodySize int64) (*call, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if c, ok := g.calls[key]; ok {
+		c.waiters++
+		return c, true
+	}
+	ctx, cancel := context.WithCancel(http_internal.DetachedContext(req.Context()))
+	// The upstream call outlives the first caller, so the Tripperware after this one can't write to its tags.
+	c := &call{
+		done:          make(chan struct{}),
+		cancel:        cancel,
+		waiters:       1,
+		tags:          http_ctxtags.ExtractOutbound(req).Copy(),
+		leaderWaiting: true,
+	}
+	g.calls[key] = c
+	go func() {
+		defer close(c.done)
+		resp, err := next.RoundTrip(req.WithContext(http_ctxtags.SetOutboundInContext(ctx, c.tags)))
+		if err == nil {
+			c.body, err = ioutil.ReadAll(io.LimitReader(resp.Body, maxBodySize+1))
+			if err == nil && int64(len(c.body)) > maxBodySize {
+				g.forget(key, c)
+				g.keepStream(c, resp)
+				return
+			}
+			resp.Body.Close()
+			if err == nil {
+				c.resp = resp
+			}
+		}
+		c.err = err
+		g.forget(key, c)
+		cancel()
+	}()
+	return c, false
+}
+
+// keepStream keeps the response with a body too large to share for the caller that started the call, if it still
+// waits for it.
+func (g *group) keepStream(c *call, resp *http.Response) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	c.tooLarge = true
+	if !c.leaderWaiting {
+		resp.Body.Close()
+		c.cancel()
+		return
+	}
+	body := resp.Body
+	stream := &http.Response{}
+	*stream = *resp
+	stream.Body = http_internal.ReleaseOnCloseBody(struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(c.body), body), body}, c.cancel)
+	c.body = nil
+	c.stream = stream
+}
+
+// claimStream returns the response with a body too large to share, if the caller started the call.
+func (g *group) claimStream(c *call, leader bool) *http.Response {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !leader {
+		return nil
+	}
+	stream := c.stream
+	c.stream = nil
+	return stream
+}
+
+// leave removes a caller that gave up on waiting, cancelling the call once nobody waits for it.
+func (g *group) leave(key string, c *call, leader bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if leader {
+		c.leaderWaiting = false
+		if c.stream != nil {
+			c.stream.Body.Close()
+			c.stream = nil
+		}
+	}
+	c.waiters--
+	if c.waiters == 0 {
+		if g.calls[key] == c {
+			delete(g.calls, key)
+		}
+		c.cancel()
+	}
+}
+
+func (g *group) forget(key string, c *call) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+}
+
+// copyTags sets the tags of the upstream call that the caller doesn't have, e.g. ones set by later Tripperware.
+func (c *call) copyTags(tags *http_ctxtags.Tags) {
+	for k, v := range c.tags.Values() {
+		if !tags.Has(k) {
+			tags.Set(k, v)
+		}
+	}
+}
+
+// response returns a copy of the response of the call for one of the callers.
+func (c *call) response(req *http.Request) (*http.Response, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	resp := &http.Response{}
+	*resp = *c.resp
+	resp.Header = http_internal.CloneHeader(c.resp.Header)
+	resp.Trailer = http_internal.CloneHeader(c.resp.Trailer)
+	resp.Body = ioutil.NopCloser(bytes.NewReader(c.body))
+	resp.Request = req
+	return resp, nil
+}
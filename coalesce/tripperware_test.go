@@ -0,0 +1,245 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_coalesce_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/coalesce"
+	"github.com/mwitkow/go-httpwares/tags"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingTransport counts upstream calls, and blocks them until unblocked.
+type blockingTransport struct {
+	mu      sync.Mutex
+	calls   int
+	started chan *http.Request
+	unblock chan struct{}
+	errs    chan error
+	// joined receives a value for every request that joined a call in flight.
+	joined chan struct{}
+}
+
+func newBlockingTransport() *blockingTransport {
+	return &blockingTransport{
+		started: make(chan *http.Request, 10),
+		unblock: make(chan struct{}),
+		errs:    make(chan error, 10),
+		joined:  make(chan struct{}, 10),
+	}
+}
+
+func (t *blockingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	t.calls++
+	t.mu.Unlock()
+	t.started <- req
+	select {
+	case <-t.unblock:
+	case <-req.Context().Done():
+		t.errs <- req.Context().Err()
+		return nil, req.Context().Err()
+	}
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/plain"}},
+		Body:       ioutil.NopCloser(strings.NewReader("some response")),
+		Request:    req,
+	}
+	return resp, nil
+}
+
+func (t *blockingTransport) callCount() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.calls
+}
+
+type result struct {
+	resp *http.Response
+	body string
+	err  error
+	tags map[string]interface{}
+}
+
+func startRequest(client *http.Client, ctx context.Context, method string, header http.Header) chan *result {
+	results := make(chan *result, 1)
+	go func() {
+		req, _ := http.NewRequest(method, "http://something.local/someurl", nil)
+		if header != nil {
+			req.Header = header
+		}
+		tags := http_ctxtags.ExtractOutbound(req)
+		req = http_ctxtags.SetOutboundInRequest(req.WithContext(ctx), tags)
+		res := &result{}
+		res.resp, res.err = client.Do(req)
+		if res.err == nil {
+			body, _ := ioutil.ReadAll(res.resp.Body)
+			res.body = string(body)
+			res.resp.Body.Close()
+		}
+		res.tags = tags.Values()
+		results <- res
+	}()
+	return results
+}
+
+func coalescingClient(transport *blockingTransport, opts ...http_coalesce.Option) *http.Client {
+	http_coalesce.SetJoinHook(func() { transport.joined <- struct{}{} })
+	return httpwares.TripperwareChain{
+		http_ctxtags.Tripperware(),
+		http_coalesce.Tripperware(opts...),
+		httpwares.Tripperware(func(next http.RoundTripper) http.RoundTripper {
+			return httpwares.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				http_ctxtags.ExtractOutbound(req).Set("upstream", true)
+				return next.RoundTrip(req)
+			})
+		}),
+	}.WrapClient(&http.Client{Transport: transport})
+}
+
+// waitForFollowers waits until the given number of requests started after the first one joined its call.
+func waitForFollowers(t *testing.T, transport *blockingTransport, count int) {
+	for i := 0; i < count; i++ {
+		select {
+		case <-transport.joined:
+		case <-time.After(time.Second):
+			t.Fatalf("the requests must join the call in flight")
+		}
+	}
+}
+
+func TestTripperwareMergesIdenticalRequests(t *testing.T) {
+	transport := newBlockingTransport()
+	client := coalescingClient(transport)
+	first := startRequest(client, context.Background(), "GET", nil)
+	<-transport.started
+	var followers []chan *result
+	for i := 0; i < 3; i++ {
+		followers = append(followers, startRequest(client, context.Background(), "GET", nil))
+	}
+	waitForFollowers(t, transport, 3)
+	close(transport.unblock)
+
+	res := <-first
+	require.NoError(t, res.err, "the first request must not fail")
+	assert.Equal(t, "some response", res.body, "the first request must get the body")
+	assert.NotContains(t, res.tags, http_coalesce.TagForCoalesced, "the first request must not be tagged as shared")
+	assert.Equal(t, true, res.tags["upstream"], "the tags of the upstream call must be copied")
+	for _, f := range followers {
+		res := <-f
+		require.NoError(t, res.err, "merged requests must not fail")
+		assert.Equal(t, "some response", res.body, "every request must get its own copy of the body")
+		assert.Equal(t, "text/plain", res.resp.Header.Get("Content-Type"), "every request must get the headers")
+		assert.Equal(t, true, res.tags[http_coalesce.TagForCoalesced], "merged requests must be tagged as shared")
+		assert.Equal(t, true, res.tags["upstream"], "the tags of the upstream call must be copied")
+	}
+	assert.Equal(t, 1, transport.callCount(), "identical requests must be sent upstream once")
+}
+
+func TestTripperwareSendsFollowersUpstreamForLargeBodies(t *testing.T) {
+	transport := newBlockingTransport()
+	client := coalescingClient(transport, http_coalesce.WithMaxSharedBodySize(5))
+	first := startRequest(client, context.Background(), "GET", nil)
+	<-transport.started
+	follower := startRequest(client, context.Background(), "GET", nil)
+	waitForFollowers(t, transport, 1)
+	close(transport.unblock)
+
+	res := <-first
+	require.NoError(t, res.err, "the first request must not fail")
+	assert.Equal(t, "some response", res.body, "the first request must get the whole body streamed")
+	assert.Equal(t, true, res.tags["upstream"], "the tags of the upstream call must be copied")
+	res = <-follower
+	require.NoError(t, res.err, "the follower must not fail")
+	assert.Equal(t, "some response", res.body, "the follower must get the whole body from its own request")
+	assert.NotContains(t, res.tags, http_coalesce.TagForCoalesced, "responses too large to share must not be shared")
+	assert.Equal(t, 2, transport.callCount(), "the follower must be sent upstream on its own")
+}
+
+func TestTripperwareKeepsDifferentRequestsApart(t *testing.T) {
+	transport := newBlockingTransport()
+	client := coalescingClient(transport)
+	first := startRequest(client, context.Background(), "GET", http.Header{"Authorization": []string{"Bearer one"}})
+	<-transport.started
+	other := startRequest(client, context.Background(), "GET", http.Header{"Authorization": []string{"Bearer two"}})
+	<-transport.started
+	post := startRequest(client, context.Background(), "POST", http.Header{"Authorization": []string{"Bearer one"}})
+	<-transport.started
+	close(transport.unblock)
+	for _, results := range []chan *result{first, other, post} {
+		res := <-results
+		require.NoError(t, res.err)
+		assert.NotContains(t, res.tags, http_coalesce.TagForCoalesced, "different requests must not be merged")
+	}
+	assert.Equal(t, 3, transport.callCount(), "different requests must be sent upstream separately")
+}
+
+func TestTripperwareKeepsRangeAndConditionalRequestsApart(t *testing.T) {
+	transport := newBlockingTransport()
+	client := coalescingClient(transport)
+	var results []chan *result
+	for _, header := range []http.Header{
+		{"Range": []string{"bytes=0-99"}},
+		{"Range": []string{"bytes=0-99"}},
+		{"If-None-Match": []string{`"some-etag"`}},
+		{"If-None-Match": []string{`"some-etag"`}},
+	} {
+		results = append(results, startRequest(client, context.Background(), "GET", header))
+		<-transport.started
+	}
+	close(transport.unblock)
+	for _, res := range results {
+		res := <-res
+		require.NoError(t, res.err)
+		assert.NotContains(t, res.tags, http_coalesce.TagForCoalesced, "range and conditional requests must not be merged")
+	}
+	assert.Equal(t, 4, transport.callCount(), "range and conditional requests must be sent upstream separately")
+}
+
+func TestTripperwareDoesNotCancelOthersWithFirstCaller(t *testing.T) {
+	transport := newBlockingTransport()
+	client := coalescingClient(transport)
+	ctx, cancel := context.WithCancel(context.Background())
+	first := startRequest(client, ctx, "GET", nil)
+	<-transport.started
+	follower := startRequest(client, context.Background(), "GET", nil)
+	waitForFollowers(t, transport, 1)
+	cancel()
+	res := <-first
+	assert.Error(t, res.err, "the first request must fail with its context")
+	close(transport.unblock)
+	res = <-follower
+	require.NoError(t, res.err, "the other requests must not be cancelled")
+	assert.Equal(t, "some response", res.body)
+	assert.Equal(t, 1, transport.callCount(), "identical requests must be sent upstream once")
+}
+
+func TestTripperwareCancelsUpstreamOnceAllCallersAreGone(t *testing.T) {
+	transport := newBlockingTransport()
+	client := coalescingClient(transport)
+	ctx, cancel := context.WithCancel(context.Background())
+	first := startRequest(client, ctx, "GET", nil)
+	<-transport.started
+	follower := startRequest(client, ctx, "GET", nil)
+	waitForFollowers(t, transport, 1)
+	cancel()
+	<-first
+	<-follower
+	select {
+	case err := <-transport.errs:
+		assert.Equal(t, context.Canceled, err, "the upstream call must be cancelled")
+	case <-time.After(time.Second):
+		t.Fatalf("the upstream call must be cancelled once no caller waits for it")
+	}
+}
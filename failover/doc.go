@@ -0,0 +1,18 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+/*
+`http_failover` is a HTTP client-side Tripperware that fails requests over to secondary hosts or regions.
+
+Requests are sent to their own URL first. If that fails with an error, or returns a response that is discarded (by the
+same `http_retry.ResponseDiscarderFunc` as used for retries), the request is sent again to each of the fallback base
+URLs in order, until one of them succeeds. Only the scheme and the host of the fallback URLs are used, the path and the
+query of the request are kept.
+
+Just like for retries, only safe and idempotent requests with a body that can be sent again are failed over, see
+`WithDecider`. Place `http_retry.Tripperware` after this Tripperware to retry each of the targets before failing over
+to the next one.
+
+The target that served the request is recorded in the `http.failover.target` tag.
+*/
+package http_failover
@@ -0,0 +1,49 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_failover
+
+import (
+	"github.com/mwitkow/go-httpwares/retry"
+)
+
+var (
+	defaultOptions = &options{
+		decider:   http_retry.DefaultRetriableDecider,
+		discarder: http_retry.DefaultResponseDiscarder,
+	}
+)
+
+type options struct {
+	decider   http_retry.RequestRetryDeciderFunc
+	discarder http_retry.ResponseDiscarderFunc
+}
+
+func evaluateOptions(opts []Option) *options {
+	optCopy := &options{}
+	*optCopy = *defaultOptions
+	for _, o := range opts {
+		o(optCopy)
+	}
+	return optCopy
+}
+
+type Option func(*options)
+
+// WithDecider is a function that allows users to customize the logic that decides whether a request can be failed over.
+//
+// By default `http_retry.DefaultRetriableDecider` is used.
+func WithDecider(f http_retry.RequestRetryDeciderFunc) Option {
+	return func(o *options) {
+		o.decider = f
+	}
+}
+
+// WithResponseDiscarder is a function that decides whether a given response should be discarded and the next target tried.
+//
+// By default `http_retry.DefaultResponseDiscarder` is used.
+func WithResponseDiscarder(f http_retry.ResponseDiscarderFunc) Option {
+	return func(o *options) {
+		o.discarder = f
+	}
+}
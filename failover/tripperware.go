@@ -0,0 +1,83 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_failover
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/internal"
+	"github.com/mwitkow/go-httpwares/tags"
+)
+
+const (
+	// TagForFailoverTarget is a string naming the ctxtag with the scheme and host of the target that served a request.
+	TagForFailoverTarget = "http.failover.target"
+)
+
+// Tripperware is client side HTTP ware that fails requests over to the given fallback base URLs, in order.
+func Tripperware(fallbacks []*url.URL, opts ...Option) httpwares.Tripperware {
+	o := evaluateOptions(opts)
+	return func(next http.RoundTripper) http.RoundTripper {
+		return httpwares.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			tags := http_ctxtags.ExtractOutbound(req)
+			if len(fallbacks) == 0 || !o.decider(req) || !http_internal.IsReplayable(req) {
+				tags.Set(TagForFailoverTarget, targetName(req.URL))
+				return next.RoundTrip(req)
+			}
+			var resp *http.Response
+			var err error
+			for i := 0; i <= len(fallbacks); i++ {
+				target := req.URL
+				if i > 0 {
+					http_internal.DrainAndClose(resp) // the response is discarded, release the connection.
+					if ctxErr := req.Context().Err(); ctxErr != nil {
+						return nil, ctxErr
+					}
+					target = fallbacks[i-1]
+				}
+				var targetReq *http.Request
+				targetReq, err = newTargetRequest(req, target, i > 0)
+				if err != nil {
+					return nil, err
+				}
+				tags.Set(TagForFailoverTarget, targetName(target))
+				resp, err = next.RoundTrip(targetReq)
+				if err == nil && !o.discarder(resp) {
+					return resp, nil
+				}
+				if err != nil && req.Context().Err() != nil {
+					return nil, err // the caller gave up, there's no point in failing over.
+				}
+			}
+			return resp, err
+		})
+	}
+}
+
+// newTargetRequest makes a copy of the request sent to the scheme and host of the target, with a fresh copy of the body.
+func newTargetRequest(req *http.Request, target *url.URL, isFallback bool) (*http.Request, error) {
+	targetReq := req.WithContext(req.Context()) // make a copy.
+	if isFallback {
+		u := *req.URL
+		u.Scheme = target.Scheme
+		u.Host = target.Host
+		targetReq.URL = &u
+		targetReq.Host = target.Host // the Host header of the primary target is meaningless to the fallback.
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("failed reading body for failover: %v", err)
+		}
+		targetReq.Body = body
+	}
+	return targetReq, nil
+}
+
+func targetName(target *url.URL) string {
+	return target.Scheme + "://" + target.Host
+}
@@ -0,0 +1,108 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_failover_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/failover"
+	"github.com/mwitkow/go-httpwares/tags"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// targetsTransport responds by the host of the request, recording the requests it got.
+type targetsTransport struct {
+	requests []*http.Request
+	bodies   []string
+	codes    map[string]int
+}
+
+func (t *targetsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests = append(t.requests, req)
+	if req.Body != nil {
+		body, _ := ioutil.ReadAll(req.Body)
+		t.bodies = append(t.bodies, string(body))
+	}
+	code, ok := t.codes[req.URL.Host]
+	if !ok {
+		return nil, errors.New("connection refused")
+	}
+	return &http.Response{StatusCode: code, Body: ioutil.NopCloser(strings.NewReader("")), Request: req}, nil
+}
+
+func mustParse(rawurl string) *url.URL {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+func failoverClient(transport http.RoundTripper, opts ...http_failover.Option) *http.Client {
+	fallbacks := []*url.URL{mustParse("https://eu.backend.com"), mustParse("http://us.backend.com:8080/ignored")}
+	return httpwares.TripperwareChain{
+		http_ctxtags.Tripperware(),
+		http_failover.Tripperware(fallbacks, opts...),
+	}.WrapClient(&http.Client{Transport: transport})
+}
+
+func do(t *testing.T, client *http.Client, method string) (*http.Response, map[string]interface{}) {
+	req, _ := http.NewRequest(method, "http://primary.backend.com/some/path?some=query", strings.NewReader("some body"))
+	tags := http_ctxtags.ExtractOutbound(req)
+	resp, err := client.Do(http_ctxtags.SetOutboundInRequest(req, tags))
+	require.NoError(t, err, "call shouldn't fail")
+	return resp, tags.Values()
+}
+
+func TestTripperwareFailsOverInOrder(t *testing.T) {
+	transport := &targetsTransport{codes: map[string]int{
+		"primary.backend.com": http.StatusServiceUnavailable,
+		"us.backend.com:8080": http.StatusOK,
+	}}
+	resp, tags := do(t, failoverClient(transport), "GET")
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "the response of the working fallback must be returned")
+	require.Len(t, transport.requests, 3, "all targets must be tried in order")
+	assert.Equal(t, "http://primary.backend.com/some/path?some=query", transport.requests[0].URL.String())
+	assert.Equal(t, "https://eu.backend.com/some/path?some=query", transport.requests[1].URL.String(), "the scheme and host must be rewritten")
+	assert.Equal(t, "http://us.backend.com:8080/some/path?some=query", transport.requests[2].URL.String(), "the path and query must be kept")
+	assert.Equal(t, "us.backend.com:8080", transport.requests[2].Host, "the host header must be the fallback's")
+	assert.Equal(t, []string{"some body", "some body", "some body"}, transport.bodies, "every target must get the whole body")
+	assert.Equal(t, "http://us.backend.com:8080", tags[http_failover.TagForFailoverTarget], "the target that served the request must be tagged")
+}
+
+func TestTripperwareDoesNotFailOverWorkingPrimary(t *testing.T) {
+	transport := &targetsTransport{codes: map[string]int{"primary.backend.com": http.StatusNotFound}}
+	resp, tags := do(t, failoverClient(transport), "GET")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "responses that are not discarded must be returned")
+	assert.Len(t, transport.requests, 1, "working primaries must not be failed over")
+	assert.Equal(t, "http://primary.backend.com", tags[http_failover.TagForFailoverTarget])
+}
+
+func TestTripperwareReturnsLastFailure(t *testing.T) {
+	transport := &targetsTransport{codes: map[string]int{"us.backend.com:8080": http.StatusServiceUnavailable}}
+	resp, _ := do(t, failoverClient(transport), "GET")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode, "the last response must be returned if all targets fail")
+	assert.Len(t, transport.requests, 3)
+}
+
+func TestTripperwareRespectsDeciderAndDiscarder(t *testing.T) {
+	transport := &targetsTransport{codes: map[string]int{"primary.backend.com": http.StatusServiceUnavailable, "eu.backend.com": http.StatusOK}}
+	do(t, failoverClient(transport), "POST")
+	assert.Len(t, transport.requests, 1, "unsafe requests must not be failed over by default")
+
+	transport.requests = nil
+	transport.codes["primary.backend.com"] = http.StatusTooManyRequests
+	resp, _ := do(t, failoverClient(transport, http_failover.WithResponseDiscarder(func(resp *http.Response) bool {
+		return resp.StatusCode == http.StatusServiceUnavailable
+	})), "GET")
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode, "responses kept by the custom discarder must be returned")
+	assert.Len(t, transport.requests, 1)
+}
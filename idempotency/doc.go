@@ -0,0 +1,25 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+/*
+`http_idempotency` makes non-idempotent requests, such as POSTs, safe to retry using an `Idempotency-Key` header.
+
+Client-side Key Generation
+
+The client-side `Tripperware` attaches an `Idempotency-Key` header to requests that don't have one (by default POST and
+PATCH requests), and enables `http_retry` for them. The key is generated once per logical request, so it needs to be
+placed *before* `http_retry.Tripperware` in the chain, for all attempts to share the same key.
+
+Server-side Deduplication
+
+The server-side `Middleware` stores responses by their key in a pluggable `Store`, and replays the stored response for
+requests with a key that was already seen, without calling the handler again. Replayed responses have the
+`Idempotent-Replayed` header set. Requests that arrive while another one with the same key is being handled are rejected
+with 409 Conflict, and requests reusing a key with a different body are rejected with 422 Unprocessable Entity, as they
+are most likely a client bug. By default 5xx responses are not stored, allowing the client to retry them. Response
+bodies are buffered in memory for storing, responses larger than `WithMaxBodySize` are streamed to the client and not
+stored.
+
+`NewMemoryStore` provides an in-memory `Store` suitable for a single server instance.
+*/
+package http_idempotency
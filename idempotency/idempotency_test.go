@@ -0,0 +1,178 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_idempotency_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/idempotency"
+	"github.com/mwitkow/go-httpwares/retry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTripperwareReusesKeyAcrossRetries(t *testing.T) {
+	var keys []string
+	transport := httpwares.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		keys = append(keys, req.Header.Get(http_idempotency.HeaderName))
+		code := http.StatusServiceUnavailable
+		if len(keys) > 1 {
+			code = http.StatusOK
+		}
+		return &http.Response{StatusCode: code, Body: ioutil.NopCloser(strings.NewReader("")), Request: req}, nil
+	})
+	client := httpwares.TripperwareChain{
+		http_idempotency.Tripperware(),
+		http_retry.Tripperware(http_retry.WithBackoff(http_retry.BackoffLinear(0))),
+	}.WrapClient(&http.Client{Transport: transport})
+	req, _ := http.NewRequest("POST", "http://something.local/payments", strings.NewReader("body"))
+	resp, err := client.Do(req)
+	require.NoError(t, err, "call shouldn't fail")
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "the POST must be retried")
+	require.Len(t, keys, 2, "the POST must be sent twice")
+	assert.NotEmpty(t, keys[0], "the key must be set")
+	assert.Equal(t, keys[0], keys[1], "all attempts must share the same key")
+	assert.Empty(t, req.Header.Get(http_idempotency.HeaderName), "the headers of the caller must not be modified")
+}
+
+func TestTripperwareKeepsExistingKey(t *testing.T) {
+	var key string
+	transport := httpwares.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		key = req.Header.Get(http_idempotency.HeaderName)
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("")), Request: req}, nil
+	})
+	client := httpwares.TripperwareChain{http_idempotency.Tripperware()}.WrapClient(&http.Client{Transport: transport})
+	req, _ := http.NewRequest("POST", "http://something.local/payments", strings.NewReader("body"))
+	req.Header.Set(http_idempotency.HeaderName, "my-key")
+	_, err := client.Do(req)
+	require.NoError(t, err, "call shouldn't fail")
+	assert.Equal(t, "my-key", key, "the key set by the caller must be kept")
+}
+
+func newKeyedRequest(key string) *http.Request {
+	req, _ := http.NewRequest("POST", "http://something.local/payments", strings.NewReader("body"))
+	req.Header.Set(http_idempotency.HeaderName, key)
+	return req
+}
+
+func TestMiddlewareReplaysStoredResponse(t *testing.T) {
+	calls := 0
+	handler := http_idempotency.Middleware(http_idempotency.NewMemoryStore(time.Minute))(
+		http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			calls++
+			resp.Header().Set("X-Payment", "accepted")
+			resp.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(resp, "payment %d", calls)
+		}))
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, newKeyedRequest("key-1"))
+		assert.Equal(t, http.StatusCreated, rec.Code, "the status must be the same for request %d", i)
+		assert.Equal(t, "payment 1", rec.Body.String(), "the body must be the same for request %d", i)
+		assert.Equal(t, "accepted", rec.Header().Get("X-Payment"), "the headers must be the same for request %d", i)
+		assert.Equal(t, i == 1, rec.Header().Get(http_idempotency.ReplayedHeaderName) == "true", "only the duplicate must be replayed")
+	}
+	assert.Equal(t, 1, calls, "the handler must be called once")
+
+	handler.ServeHTTP(httptest.NewRecorder(), newKeyedRequest("key-2"))
+	assert.Equal(t, 2, calls, "the handler must be called for a different key")
+}
+
+func TestMiddlewareDoesNotStoreServerErrors(t *testing.T) {
+	calls := 0
+	handler := http_idempotency.Middleware(http_idempotency.NewMemoryStore(time.Minute))(
+		http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			calls++
+			if calls == 1 {
+				resp.WriteHeader(http.StatusInternalServerError)
+			}
+		}))
+	for i := 0; i < 2; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), newKeyedRequest("key"))
+	}
+	assert.Equal(t, 2, calls, "the request must be handled again after a server error")
+}
+
+func TestMiddlewareStreamsLargeResponsesWithoutStoring(t *testing.T) {
+	calls := 0
+	handler := http_idempotency.Middleware(http_idempotency.NewMemoryStore(time.Minute), http_idempotency.WithMaxBodySize(10))(
+		http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			calls++
+			resp.Write([]byte("0123456789"))
+			resp.Write([]byte("abcdef"))
+		}))
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, newKeyedRequest("key"))
+		assert.Equal(t, "0123456789abcdef", rec.Body.String(), "the whole body must be streamed for request %d", i)
+		assert.Empty(t, rec.Header().Get(http_idempotency.ReplayedHeaderName), "the response must not be replayed")
+	}
+	assert.Equal(t, 2, calls, "the request must be handled again if its response was too large to store")
+}
+
+func TestMiddlewareRejectsKeysReusedWithDifferentBody(t *testing.T) {
+	calls := 0
+	handler := http_idempotency.Middleware(http_idempotency.NewMemoryStore(time.Minute))(
+		http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			calls++
+			buf := make([]byte, 2)
+			req.Body.Read(buf) // the rest of the body must still be hashed.
+			resp.WriteHeader(http.StatusCreated)
+		}))
+	handler.ServeHTTP(httptest.NewRecorder(), newKeyedRequest("key"))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newKeyedRequest("key"))
+	assert.Equal(t, http.StatusCreated, rec.Code, "duplicates with the same body must be replayed")
+
+	req := httptest.NewRequest("POST", "http://something.local/payments", strings.NewReader("other body"))
+	req.Header.Set(http_idempotency.HeaderName, "key")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code, "keys reused with a different body must be rejected")
+	assert.Empty(t, rec.Header().Get(http_idempotency.ReplayedHeaderName), "the response must not be replayed")
+	assert.Equal(t, 1, calls, "the handler must be called once")
+}
+
+func TestMiddlewareRejectsConcurrentDuplicates(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := http_idempotency.Middleware(http_idempotency.NewMemoryStore(time.Minute))(
+		http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			close(started)
+			<-release
+		}))
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		handler.ServeHTTP(httptest.NewRecorder(), newKeyedRequest("key"))
+	}()
+	<-started
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newKeyedRequest("key"))
+	close(release)
+	wg.Wait()
+	assert.Equal(t, http.StatusConflict, rec.Code, "a duplicate in flight must be rejected")
+}
+
+func TestMemoryStoreExpiresEntries(t *testing.T) {
+	store := http_idempotency.NewMemoryStore(10 * time.Millisecond)
+	_, err := store.Reserve("key")
+	require.NoError(t, err, "a new key must be reserved")
+	require.NoError(t, store.Save("key", &http_idempotency.StoredResponse{StatusCode: http.StatusOK}))
+	stored, err := store.Reserve("key")
+	require.NoError(t, err, "a stored key must not fail")
+	assert.NotNil(t, stored, "the stored response must be returned")
+	time.Sleep(20 * time.Millisecond)
+	stored, err = store.Reserve("key")
+	require.NoError(t, err, "an expired key must be reserved again")
+	assert.Nil(t, stored, "an expired response must not be returned")
+}
@@ -0,0 +1,149 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/internal"
+	"github.com/mwitkow/go-httpwares/tags"
+)
+
+const (
+	// ReplayedHeaderName is the name of the header set on responses that were replayed from the Store.
+	ReplayedHeaderName = "Idempotent-Replayed"
+
+	// TagForReplayed is a string naming the ctxtag set on requests that had their response replayed from the Store.
+	TagForReplayed = "http.idempotency.replayed"
+)
+
+// Middleware returns a http.Handler middleware that deduplicates requests with the same idempotency key.
+//
+// Requests without the `Idempotency-Key` header are passed through. Keys are scoped to the method and URL path of the
+// request. If the Store fails, 503 is returned, as handling the request could break its idempotency. Responses with bodies
+// larger than `WithMaxBodySize` are not stored. Requests reusing a key with a different body are rejected with 422.
+func Middleware(store Store, opts ...MiddlewareOption) httpwares.Middleware {
+	o := evaluateMiddlewareOptions(opts)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			key := req.Header.Get(HeaderName)
+			if key == "" {
+				next.ServeHTTP(resp, req)
+				return
+			}
+			storeKey := req.Method + " " + req.URL.Path + " " + key
+			stored, err := store.Reserve(storeKey)
+			if err == ErrKeyInFlight {
+				http.Error(resp, "a request with the same Idempotency-Key is in progress", http.StatusConflict)
+				return
+			} else if err != nil {
+				http.Error(resp, "failed checking the Idempotency-Key", http.StatusServiceUnavailable)
+				return
+			} else if stored != nil {
+				if stored.RequestHash != nil {
+					requestHash, err := newHashingBody(req.Body).sum()
+					if err != nil {
+						http.Error(resp, "failed reading the request body", http.StatusBadRequest)
+						return
+					} else if !bytes.Equal(requestHash, stored.RequestHash) {
+						http.Error(resp, "the Idempotency-Key was already used with a different request body", http.StatusUnprocessableEntity)
+						return
+					}
+				}
+				http_ctxtags.ExtractInbound(req).Set(TagForReplayed, true)
+				replay(resp, stored)
+				return
+			}
+			saved := false
+			defer func() {
+				if !saved {
+					store.Release(storeKey) // e.g. on panics, so that the request can be retried.
+				}
+			}()
+			hashedBody := newHashingBody(req.Body)
+			req.Body = hashedBody
+			captured := &StoredResponse{StatusCode: http.StatusOK}
+			body := &bytes.Buffer{}
+			tooLarge := false
+			wrapped := httpwares.WrapResponseWriter(resp)
+			wrapped.ObserveWriteHeader(func(w httpwares.WrappedResponseWriter, code int) {
+				captured.StatusCode = code
+				captured.Header = http_internal.CloneHeader(w.Header())
+			})
+			wrapped.ObserveWrite(func(w httpwares.WrappedResponseWriter, buf []byte, n int, err error) {
+				if tooLarge {
+					return
+				}
+				if body.Len()+n > o.maxBodySize {
+					tooLarge = true // the rest is only streamed, the response won't be stored.
+					body = nil
+					return
+				}
+				body.Write(buf[:n])
+			})
+			next.ServeHTTP(wrapped, req)
+			if captured.Header == nil {
+				captured.Header = http_internal.CloneHeader(wrapped.Header())
+			}
+			if tooLarge {
+				return
+			}
+			captured.Body = body.Bytes()
+			if captured.RequestHash, err = hashedBody.sum(); err != nil {
+				return // e.g. the handler closed the body half read, the duplicates can't be checked.
+			}
+			if o.storeDecider(captured.StatusCode) {
+				saved = store.Save(storeKey, captured) == nil
+			}
+		})
+	}
+}
+
+func replay(resp http.ResponseWriter, stored *StoredResponse) {
+	for k, vv := range stored.Header {
+		resp.Header()[k] = append([]string(nil), vv...)
+	}
+	resp.Header().Set(ReplayedHeaderName, "true")
+	resp.WriteHeader(stored.StatusCode)
+	resp.Write(stored.Body)
+}
+
+// hashingBody hashes the request body as it is read.
+type hashingBody struct {
+	io.ReadCloser
+	hash hash.Hash
+	eof  bool
+}
+
+func newHashingBody(body io.ReadCloser) *hashingBody {
+	if body == nil {
+		body = ioutil.NopCloser(bytes.NewReader(nil))
+	}
+	return &hashingBody{ReadCloser: body, hash: sha256.New()}
+}
+
+func (b *hashingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.hash.Write(p[:n])
+	if err == io.EOF {
+		b.eof = true
+	}
+	return n, err
+}
+
+// sum returns the hash of the whole body, reading the part that wasn't read yet.
+func (b *hashingBody) sum() ([]byte, error) {
+	if !b.eof {
+		if _, err := io.Copy(ioutil.Discard, b); err != nil {
+			return nil, err
+		}
+	}
+	return b.hash.Sum(nil), nil
+}
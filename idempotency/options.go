@@ -0,0 +1,124 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_idempotency
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+var (
+	defaultOptions = &options{
+		decider:      DefaultKeyDecider,
+		keyGenerator: DefaultKeyGenerator,
+	}
+	defaultMiddlewareOptions = &middlewareOptions{
+		storeDecider: DefaultStoreDecider,
+		maxBodySize:  1 << 20,
+	}
+)
+
+type options struct {
+	decider      RequestKeyDeciderFunc
+	keyGenerator KeyGeneratorFunc
+}
+
+func evaluateOptions(opts []Option) *options {
+	optCopy := &options{}
+	*optCopy = *defaultOptions
+	for _, o := range opts {
+		o(optCopy)
+	}
+	return optCopy
+}
+
+// Option configures the client-side Tripperware.
+type Option func(*options)
+
+type middlewareOptions struct {
+	storeDecider StoreDeciderFunc
+	maxBodySize  int
+}
+
+func evaluateMiddlewareOptions(opts []MiddlewareOption) *middlewareOptions {
+	optCopy := &middlewareOptions{}
+	*optCopy = *defaultMiddlewareOptions
+	for _, o := range opts {
+		o(optCopy)
+	}
+	return optCopy
+}
+
+// MiddlewareOption configures the server-side Middleware.
+type MiddlewareOption func(*middlewareOptions)
+
+// RequestKeyDeciderFunc decides whether the given request should have an idempotency key attached.
+type RequestKeyDeciderFunc func(req *http.Request) bool
+
+// KeyGeneratorFunc generates a new unique idempotency key.
+type KeyGeneratorFunc func() string
+
+// StoreDeciderFunc decides whether a response with the given status code should be stored for replaying.
+type StoreDeciderFunc func(statusCode int) bool
+
+// WithDecider is a function option that decides which requests get an idempotency key in the Tripperware.
+func WithDecider(f RequestKeyDeciderFunc) Option {
+	return func(o *options) {
+		o.decider = f
+	}
+}
+
+// WithKeyGenerator is a function option that changes how keys are generated in the Tripperware.
+func WithKeyGenerator(f KeyGeneratorFunc) Option {
+	return func(o *options) {
+		o.keyGenerator = f
+	}
+}
+
+// WithStoreDecider is a function option that decides which responses are stored for replaying in the Middleware.
+func WithStoreDecider(f StoreDeciderFunc) MiddlewareOption {
+	return func(o *middlewareOptions) {
+		o.storeDecider = f
+	}
+}
+
+// WithMaxBodySize sets the size in bytes of the largest response body buffered for storing in the Middleware, 1MiB by
+// default.
+//
+// Responses with larger bodies are streamed to the client without being stored, so retries of their requests are
+// handled again.
+func WithMaxBodySize(maxBytes int) MiddlewareOption {
+	return func(o *middlewareOptions) {
+		o.maxBodySize = maxBytes
+	}
+}
+
+// DefaultKeyDecider is the default implementation of the decider, which attaches keys to POST and PATCH requests.
+//
+// Other methods are idempotent by definition, see https://tools.ietf.org/html/rfc7231#section-4.2.2
+func DefaultKeyDecider(req *http.Request) bool {
+	return req.Method == "POST" || req.Method == "PATCH"
+}
+
+// DefaultKeyGenerator generates random version 4 UUIDs.
+//
+// It panics if the system's secure random number generator fails.
+func DefaultKeyGenerator() string {
+	b := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		panic(fmt.Sprintf("http_idempotency: failed generating key: %v", err))
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// DefaultStoreDecider is the default implementation of the store decider, which stores all but 5xx responses.
+//
+// Server errors are usually transient, and the client should be able to retry them.
+func DefaultStoreDecider(statusCode int) bool {
+	return statusCode < 500
+}
@@ -0,0 +1,99 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_idempotency
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrKeyInFlight is returned by `Store.Reserve` if a request with the same key is being handled.
+var ErrKeyInFlight = errors.New("http_idempotency: request with the same key is in flight")
+
+// StoredResponse is a response kept in the Store for replaying.
+type StoredResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// RequestHash is the SHA-256 hash of the body of the request that got the response. If set, it must match the body
+	// of requests the response is replayed to.
+	RequestHash []byte
+}
+
+// Store keeps the responses to requests by their idempotency keys.
+//
+// Implementations need to be safe for concurrent use. To share keys between many server instances, a Store backed by
+// a shared database can be used.
+type Store interface {
+	// Reserve marks the key as in flight, returning nil if it wasn't seen before. If a response was already stored for
+	// the key it is returned, and if a request with the key is in flight `ErrKeyInFlight` is returned.
+	Reserve(key string) (*StoredResponse, error)
+	// Save stores the response for a reserved key.
+	Save(key string, resp *StoredResponse) error
+	// Release removes the reservation of the key, without storing a response.
+	Release(key string) error
+}
+
+// MemoryStore is a Store that keeps the responses in memory for a given time.
+type MemoryStore struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]*memoryEntry
+	lastSweep time.Time
+}
+
+type memoryEntry struct {
+	resp    *StoredResponse // nil while in flight.
+	expires time.Time
+}
+
+// NewMemoryStore creates a new in-memory Store, keeping responses and reservations of keys for the ttl.
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{ttl: ttl, entries: make(map[string]*memoryEntry), lastSweep: time.Now()}
+}
+
+func (s *MemoryStore) Reserve(key string) (*StoredResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.sweep(now)
+	if e, ok := s.entries[key]; ok && now.Before(e.expires) {
+		if e.resp == nil {
+			return nil, ErrKeyInFlight
+		}
+		return e.resp, nil
+	}
+	s.entries[key] = &memoryEntry{expires: now.Add(s.ttl)}
+	return nil, nil
+}
+
+func (s *MemoryStore) Save(key string, resp *StoredResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = &memoryEntry{resp: resp, expires: time.Now().Add(s.ttl)}
+	return nil
+}
+
+func (s *MemoryStore) Release(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// sweep removes the expired entries, at most once per ttl.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < s.ttl {
+		return
+	}
+	s.lastSweep = now
+	for key, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_idempotency
+
+import (
+	"net/http"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/internal"
+	"github.com/mwitkow/go-httpwares/retry"
+)
+
+const (
+	// HeaderName is the name of the header carrying the idempotency key.
+	HeaderName = "Idempotency-Key"
+)
+
+// Tripperware is client side HTTP ware that attaches idempotency keys to requests, making them safe to retry.
+//
+// Requests that the decider (see `WithDecider`) selects get a new key, unless they already have one set, and have
+// `http_retry.Enable` set on them. This Tripperware needs to be placed before `http_retry.Tripperware` in the chain.
+func Tripperware(opts ...Option) httpwares.Tripperware {
+	o := evaluateOptions(opts)
+	return func(next http.RoundTripper) http.RoundTripper {
+		return httpwares.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if !o.decider(req) {
+				return next.RoundTrip(req)
+			}
+			if req.Header.Get(HeaderName) == "" {
+				// This makes a copy of the request, so that the headers of the caller are not affected.
+				newReq := req.WithContext(req.Context())
+				newReq.Header = http_internal.CloneHeader(req.Header)
+				newReq.Header.Set(HeaderName, o.keyGenerator())
+				req = newReq
+			}
+			return next.RoundTrip(http_retry.Enable(req))
+		})
+	}
+}
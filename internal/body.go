@@ -0,0 +1,29 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_internal
+
+import (
+	"io"
+	"sync"
+)
+
+// ReleaseOnCloseBody wraps a response body so that release is called once the body is closed.
+//
+// This is meant for Tripperware that hold resources (slots, connections) for the whole lifetime of a request, including
+// reading the response body. Release is called at most once, even if the body is closed many times.
+func ReleaseOnCloseBody(body io.ReadCloser, release func()) io.ReadCloser {
+	return &releaseOnCloseBody{ReadCloser: body, release: release}
+}
+
+type releaseOnCloseBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releaseOnCloseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
@@ -0,0 +1,25 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_internal_test
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/mwitkow/go-httpwares/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReleaseOnCloseBodyReleasesOnce(t *testing.T) {
+	released := 0
+	body := http_internal.ReleaseOnCloseBody(ioutil.NopCloser(strings.NewReader("content")), func() { released++ })
+	content, err := ioutil.ReadAll(body)
+	assert.NoError(t, err, "reading the body must not fail")
+	assert.Equal(t, "content", string(content), "the body must be passed through")
+	assert.Equal(t, 0, released, "release must not be called before close")
+	body.Close()
+	body.Close()
+	assert.Equal(t, 1, released, "release must be called exactly once")
+}
@@ -0,0 +1,36 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_internal
+
+import (
+	"context"
+	"time"
+)
+
+// DetachedContext returns a Context that keeps the values of its parent, but not its deadline or cancellation.
+//
+// This is meant for requests that outlive the request that started them, e.g. shadow or shared upstream requests.
+func DetachedContext(parent context.Context) context.Context {
+	return detachedContext{parent: parent}
+}
+
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
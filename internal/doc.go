@@ -0,0 +1,9 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+/*
+Package `http_internal` contains helpers shared by the wares of this repository.
+
+They are not part of the public API and may change at any time.
+*/
+package http_internal
@@ -0,0 +1,14 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_internal
+
+import "net/url"
+
+// UnwrapURLError returns the error returned by the RoundTripper, if err was wrapped by `http.Client` in a `*url.Error`.
+func UnwrapURLError(err error) error {
+	if urlErr, ok := err.(*url.Error); ok {
+		return urlErr.Err
+	}
+	return err
+}
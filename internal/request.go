@@ -0,0 +1,25 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_internal
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// IsReplayable checks whether the body of the request can be sent again, e.g. by retries or to another host.
+func IsReplayable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// DrainAndClose reads a bit of the body of a discarded response before closing it, so that the connection can be
+// reused.
+func DrainAndClose(resp *http.Response) {
+	if resp == nil || resp.Body == nil {
+		return
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+}
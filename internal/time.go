@@ -0,0 +1,15 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_internal
+
+import "time"
+
+// TimeDiffToMilliseconds returns the time passed since then in milliseconds, as used by the `*_ms` tags and log fields.
+func TimeDiffToMilliseconds(then time.Time) float32 {
+	sub := time.Now().Sub(then).Nanoseconds()
+	if sub < 0 {
+		return 0.0
+	}
+	return float32(sub/1000) / 1000.0
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/sirupsen/logrus"
 	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/internal"
 )
 
 var (
@@ -39,7 +40,7 @@ func Middleware(entry *logrus.Entry, opts ...Option) httpwares.Middleware {
 
 			postCallFields := logrus.Fields{
 				"http.status":  wrappedResp.StatusCode(),
-				"http.time_ms": timeDiffToMilliseconds(startTime),
+				"http.time_ms": http_internal.TimeDiffToMilliseconds(startTime),
 			}
 			level := o.levelFunc(wrappedResp.StatusCode())
 			levelLogf(
@@ -79,11 +80,3 @@ func levelLogf(entry *logrus.Entry, level logrus.Level, format string, args ...i
 		entry.Panicf(format, args...)
 	}
 }
-
-func timeDiffToMilliseconds(then time.Time) float32 {
-	sub := time.Now().Sub(then).Nanoseconds()
-	if sub < 0 {
-		return 0.0
-	}
-	return float32(sub/1000) / 1000.0
-}
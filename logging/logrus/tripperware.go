@@ -9,6 +9,7 @@ import (
 
 	"github.com/sirupsen/logrus"
 	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/internal"
 	"github.com/mwitkow/go-httpwares/tags"
 )
 
@@ -21,13 +22,13 @@ func Tripperware(entry *logrus.Entry, opts ...Option) httpwares.Tripperware {
 		o := evaluateTripperwareOpts(opts)
 		return httpwares.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
 			startTime := time.Now()
-			fields := newClientRequestFields(req)
 			resp, err := next.RoundTrip(req)
+			fields := newClientRequestFields(req) // after the call, so that tags set by later Tripperware are included.
 			if err != nil {
 				logError(o.levelForConnectivityError, entry.WithFields(fields), err)
 				return resp, err
 			}
-			fields["http.time_ms"] = timeDiffToMilliseconds(startTime)
+			fields["http.time_ms"] = http_internal.TimeDiffToMilliseconds(startTime)
 			fields["http.proto_major"] = resp.ProtoMajor
 			fields["http.response.length_bytes"] = resp.ContentLength
 			fields["http.status"] = resp.StatusCode
@@ -4,3 +4,53 @@ import "net/http"
 
 // Middleware is signature of all http server-side middleware.
 type Middleware func(http.Handler) http.Handler
+
+// MiddlewareChain is a chain of middleware before dispatching to the handler.
+type MiddlewareChain []Middleware
+
+// Forge takes a chain and finalizes it, attaching it to a final http.Handler.
+//
+// The first middleware in the chain is the outermost one, i.e. it sees the request first.
+func (chain MiddlewareChain) Forge(final http.Handler) http.Handler {
+	next := final
+	for i := len(chain) - 1; i >= 0; i-- {
+		next = chain[i](next)
+	}
+	return next
+}
+
+// ForgeFunc takes a chain and finalizes it, attaching it to a final http.HandlerFunc.
+func (chain MiddlewareChain) ForgeFunc(final http.HandlerFunc) http.Handler {
+	return chain.Forge(final)
+}
+
+// Append returns a new chain with the given middleware added at the end (closest to the handler).
+//
+// The original chain is not modified.
+func (chain MiddlewareChain) Append(wares ...Middleware) MiddlewareChain {
+	newChain := make(MiddlewareChain, 0, len(chain)+len(wares))
+	newChain = append(newChain, chain...)
+	return append(newChain, wares...)
+}
+
+// Prepend returns a new chain with the given middleware added at the beginning (furthest from the handler).
+//
+// The original chain is not modified.
+func (chain MiddlewareChain) Prepend(wares ...Middleware) MiddlewareChain {
+	newChain := make(MiddlewareChain, 0, len(chain)+len(wares))
+	newChain = append(newChain, wares...)
+	return append(newChain, chain...)
+}
+
+// WrapServer takes an http.Server and wraps its handler in the chain of middleware.
+//
+// Unlike TripperwareChain.WrapClient this modifies the server in place, as an http.Server must not be copied. If no
+// handler is set, the http.DefaultServeMux is wrapped.
+func (chain MiddlewareChain) WrapServer(server *http.Server) *http.Server {
+	finalHandler := server.Handler
+	if finalHandler == nil { // in case of DefaultServeMux
+		finalHandler = http.DefaultServeMux
+	}
+	server.Handler = chain.Forge(finalHandler)
+	return server
+}
@@ -0,0 +1,61 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package httpwares_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func assertingMiddleware(t *testing.T, placeInChain int) httpwares.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			for i := 0; i < placeInChain; i++ {
+				require.NotEmpty(t, req.Header.Get(fmt.Sprintf("assert-%d", i)), "%d iteration of middleware must have the headers from previous ones", placeInChain)
+			}
+			req.Header.Set(fmt.Sprintf("assert-%d", placeInChain), "true")
+			next.ServeHTTP(resp, req)
+		})
+	}
+}
+
+func assertingFinalHandler(t *testing.T, numWares int) http.HandlerFunc {
+	return func(resp http.ResponseWriter, req *http.Request) {
+		for i := 0; i < numWares; i++ {
+			require.NotEmpty(t, req.Header.Get(fmt.Sprintf("assert-%d", i)), "the final handler must see the asserts of previous ones: %d", i)
+		}
+		resp.WriteHeader(http.StatusTeapot)
+	}
+}
+
+func TestMiddlewareChainsInFifoOrder(t *testing.T) {
+	numWares := 5
+	var wares httpwares.MiddlewareChain
+	for i := 0; i < numWares; i++ {
+		wares = append(wares, assertingMiddleware(t, i))
+	}
+	req, _ := http.NewRequest("GET", "http://whatever", nil)
+	recorder := httptest.NewRecorder()
+	wares.ForgeFunc(assertingFinalHandler(t, numWares)).ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusTeapot, recorder.Code)
+}
+
+func TestMiddlewareChainAppendAndPrepend(t *testing.T) {
+	middle := httpwares.MiddlewareChain{assertingMiddleware(t, 1), assertingMiddleware(t, 2)}
+	wares := middle.Prepend(assertingMiddleware(t, 0)).Append(assertingMiddleware(t, 3))
+	require.Len(t, middle, 2, "the original chain must not be modified")
+	require.Len(t, wares, 4, "the new chain must have all middleware")
+
+	server := wares.WrapServer(&http.Server{Handler: assertingFinalHandler(t, 4)})
+	req, _ := http.NewRequest("GET", "http://whatever", nil)
+	recorder := httptest.NewRecorder()
+	server.Handler.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusTeapot, recorder.Code)
+}
@@ -0,0 +1,20 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+/*
+`http_mirror` is a HTTP client-side Tripperware that mirrors requests to a shadow backend.
+
+A percentage of requests (see `WithPercentage`) is copied and sent to the shadow URL in the background, e.g. to
+validate a new version of a backend with real traffic. Only the scheme and the host of the shadow URL are used, the
+path and the query of the request are kept. The primary request is not affected in any way: the shadow request has its
+own timeout (see `WithTimeout`), is not cancelled with the primary request, and its response is discarded.
+
+Shadow requests are sent through the rest of the chain, with a copy of the outbound `http_ctxtags.Tags` that has the
+`http.mirror.shadow` tag set, so that logging and monitoring Tripperwares placed after this one can tell them apart.
+The `http.call.service` tag of the copy is replaced with the host of the shadow URL (see `WithServiceName`), so that
+Tripperwares keeping state per service, such as `http_balancer` or `http_breaker`, don't treat shadow requests as
+primary ones.
+
+Requests with a body are only mirrored if it can be read again, i.e. `http.Request.GetBody` is set.
+*/
+package http_mirror
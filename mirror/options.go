@@ -0,0 +1,82 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_mirror
+
+import (
+	"net/http"
+	"time"
+)
+
+var (
+	defaultOptions = &options{
+		decider:     func(*http.Request) bool { return true },
+		percentage:  100,
+		timeout:     5 * time.Second,
+		maxInFlight: 100,
+	}
+)
+
+type options struct {
+	decider     RequestMirrorDeciderFunc
+	percentage  float64
+	timeout     time.Duration
+	maxInFlight int
+	serviceName string
+}
+
+func evaluateOptions(opts []Option) *options {
+	optCopy := &options{}
+	*optCopy = *defaultOptions
+	for _, o := range opts {
+		o(optCopy)
+	}
+	return optCopy
+}
+
+type Option func(*options)
+
+// RequestMirrorDeciderFunc decides whether the given request can be mirrored.
+type RequestMirrorDeciderFunc func(req *http.Request) bool
+
+// WithDecider is a function that allows users to customize the logic that decides whether a request can be mirrored.
+//
+// By default all requests can be mirrored, make sure that the shadow backend has no side effects that matter.
+func WithDecider(f RequestMirrorDeciderFunc) Option {
+	return func(o *options) {
+		o.decider = f
+	}
+}
+
+// WithPercentage sets the percentage (0-100) of requests that are mirrored, 100 by default.
+func WithPercentage(percentage float64) Option {
+	return func(o *options) {
+		o.percentage = percentage
+	}
+}
+
+// WithTimeout sets the timeout of shadow requests, including reading their response, 5 seconds by default.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// WithMaxInFlight sets the maximum number of shadow requests in flight, 100 by default.
+//
+// Requests are not mirrored while the limit is reached, so that a slow shadow backend doesn't pile up requests.
+func WithMaxInFlight(maxInFlight int) Option {
+	return func(o *options) {
+		o.maxInFlight = maxInFlight
+	}
+}
+
+// WithServiceName sets the `http.call.service` tag of shadow requests, the host of the shadow URL by default.
+//
+// Tripperwares placed after this one that keep state per service (e.g. `http_balancer` or `http_breaker`) will keep
+// shadow requests apart from the primary ones under this name.
+func WithServiceName(serviceName string) Option {
+	return func(o *options) {
+		o.serviceName = serviceName
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_mirror
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/internal"
+	"github.com/mwitkow/go-httpwares/tags"
+)
+
+const (
+	// TagForShadow is a string naming the ctxtag set on shadow requests.
+	TagForShadow = "http.mirror.shadow"
+)
+
+// Tripperware is client side HTTP ware that mirrors requests to the given shadow URL.
+func Tripperware(shadow *url.URL, opts ...Option) httpwares.Tripperware {
+	o := evaluateOptions(opts)
+	return func(next http.RoundTripper) http.RoundTripper {
+		inFlight := int32(0)
+		return httpwares.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if shouldMirror(req, o) {
+				if atomic.AddInt32(&inFlight, 1) <= int32(o.maxInFlight) {
+					// The copy is made before the primary request is sent, as later wares may change it.
+					shadowReq, cancel := newShadowRequest(req, shadow, o)
+					go func() {
+						defer atomic.AddInt32(&inFlight, -1)
+						defer cancel()
+						sendShadow(next, shadowReq)
+					}()
+				} else {
+					atomic.AddInt32(&inFlight, -1)
+				}
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+func shouldMirror(req *http.Request, o *options) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false // the body can't be read twice.
+	}
+	return o.decider(req) && rand.Float64()*100 < o.percentage
+}
+
+// newShadowRequest makes a copy of the request sent to the shadow URL, with its own timeout and tags.
+func newShadowRequest(req *http.Request, shadow *url.URL, o *options) (*http.Request, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(http_internal.DetachedContext(req.Context()), o.timeout)
+	serviceName := o.serviceName
+	if serviceName == "" {
+		serviceName = shadow.Host
+	}
+	shadowTags := http_ctxtags.ExtractOutbound(req).Copy().Set(TagForShadow, true).Set(http_ctxtags.TagForCallService, serviceName)
+	shadowReq := req.WithContext(http_ctxtags.SetOutboundInContext(ctx, shadowTags)) // make a copy.
+	u := *req.URL
+	u.Scheme = shadow.Scheme
+	u.Host = shadow.Host
+	shadowReq.URL = &u
+	shadowReq.Host = shadow.Host
+	shadowReq.Header = http_internal.CloneHeader(req.Header)
+	shadowReq.Body = nil
+	return shadowReq, cancel
+}
+
+// sendShadow sends the shadow request, discarding the response.
+func sendShadow(next http.RoundTripper, shadowReq *http.Request) {
+	if shadowReq.GetBody != nil {
+		body, err := shadowReq.GetBody()
+		if err != nil {
+			return
+		}
+		shadowReq.Body = body
+	}
+	resp, err := next.RoundTrip(shadowReq)
+	if err != nil {
+		return
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+}
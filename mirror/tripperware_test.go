@@ -0,0 +1,175 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_mirror_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/balancer"
+	"github.com/mwitkow/go-httpwares/mirror"
+	"github.com/mwitkow/go-httpwares/tags"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type shadowCall struct {
+	req  *http.Request
+	body string
+	tags map[string]interface{}
+	err  error
+}
+
+// mirroringTransport responds to the primary host, and reports requests to the shadow host on a channel.
+type mirroringTransport struct {
+	shadows     chan *shadowCall
+	blockShadow bool
+	// waitFor holds the shadow requests until closed, if set.
+	waitFor chan struct{}
+}
+
+func (t *mirroringTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != "shadow.backend.com" {
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("primary")), Request: req}, nil
+	}
+	call := &shadowCall{req: req, tags: http_ctxtags.ExtractOutbound(req).Values()}
+	if req.Body != nil {
+		body, _ := ioutil.ReadAll(req.Body)
+		call.body = string(body)
+	}
+	if t.waitFor != nil {
+		<-t.waitFor
+	}
+	if t.blockShadow {
+		<-req.Context().Done()
+	}
+	call.err = req.Context().Err()
+	t.shadows <- call
+	return &http.Response{StatusCode: http.StatusInternalServerError, Body: ioutil.NopCloser(strings.NewReader("shadow")), Request: req}, nil
+}
+
+func mirroringClient(transport http.RoundTripper, opts ...http_mirror.Option) *http.Client {
+	shadow, _ := url.Parse("https://shadow.backend.com")
+	return httpwares.TripperwareChain{
+		http_ctxtags.Tripperware(),
+		http_mirror.Tripperware(shadow, opts...),
+	}.WrapClient(&http.Client{Transport: transport})
+}
+
+func TestTripperwareMirrorsRequests(t *testing.T) {
+	transport := &mirroringTransport{shadows: make(chan *shadowCall, 1), waitFor: make(chan struct{})}
+	client := mirroringClient(transport)
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequest("POST", "http://primary.backend.com/some/path?some=query", strings.NewReader("some body"))
+	req.Header.Set("X-Some", "header")
+	tags := http_ctxtags.ExtractOutbound(req)
+	resp, err := client.Do(http_ctxtags.SetOutboundInRequest(req.WithContext(ctx), tags))
+	require.NoError(t, err, "call shouldn't fail")
+	cancel()
+	close(transport.waitFor)
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "the primary response must be returned")
+	assert.Equal(t, "primary", string(body))
+	assert.NotContains(t, tags.Values(), http_mirror.TagForShadow, "the primary request must not be tagged as shadow")
+
+	select {
+	case shadow := <-transport.shadows:
+		assert.Equal(t, "https://shadow.backend.com/some/path?some=query", shadow.req.URL.String(), "the path and query must be kept")
+		assert.Equal(t, "shadow.backend.com", shadow.req.Host)
+		assert.Equal(t, "header", shadow.req.Header.Get("X-Some"), "the headers must be copied")
+		assert.Equal(t, "some body", shadow.body, "the body must be copied")
+		assert.Equal(t, true, shadow.tags[http_mirror.TagForShadow], "the shadow request must be tagged")
+		assert.Equal(t, "shadow.backend.com", shadow.tags[http_ctxtags.TagForCallService], "the shadow request must not be tagged with the primary service")
+		assert.NoError(t, shadow.err, "the shadow request must not be cancelled with the primary")
+	case <-time.After(time.Second):
+		t.Fatalf("the request must be mirrored")
+	}
+}
+
+func TestTripperwareTimesOutShadowRequests(t *testing.T) {
+	transport := &mirroringTransport{shadows: make(chan *shadowCall, 1), blockShadow: true}
+	client := mirroringClient(transport, http_mirror.WithTimeout(20*time.Millisecond))
+	req, _ := http.NewRequest("GET", "http://primary.backend.com/some/path", nil)
+	resp, err := client.Do(req)
+	require.NoError(t, err, "call shouldn't fail")
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "the primary request must not wait for the shadow")
+	select {
+	case shadow := <-transport.shadows:
+		assert.Equal(t, context.DeadlineExceeded, shadow.err, "the shadow request must time out")
+	case <-time.After(time.Second):
+		t.Fatalf("the shadow request must time out")
+	}
+}
+
+func TestTripperwareSkipsRequests(t *testing.T) {
+	transport := &mirroringTransport{shadows: make(chan *shadowCall, 3)}
+	client := mirroringClient(transport, http_mirror.WithPercentage(0))
+	req, _ := http.NewRequest("GET", "http://primary.backend.com/some/path", nil)
+	_, err := client.Do(req)
+	require.NoError(t, err)
+
+	client = mirroringClient(transport)
+	req, _ = http.NewRequest("POST", "http://primary.backend.com/some/path", ioutil.NopCloser(bytes.NewReader([]byte("opaque"))))
+	_, err = client.Do(req)
+	require.NoError(t, err)
+
+	select {
+	case <-transport.shadows:
+		t.Fatalf("requests that are not sampled, or whose body can't be read twice, must not be mirrored")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestTripperwareKeepsShadowRequestsApartInBalancer(t *testing.T) {
+	for _, tcase := range []struct {
+		name             string
+		opts             []http_mirror.Option
+		expectedService  string
+		expectedEndpoint interface{}
+	}{
+		{
+			name:            "DefaultsToShadowHost",
+			expectedService: "shadow.backend.com",
+		},
+		{
+			name:             "WithServiceName",
+			opts:             []http_mirror.Option{http_mirror.WithServiceName("backend-shadow")},
+			expectedService:  "backend-shadow",
+			expectedEndpoint: "shadow.backend.com",
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			balancer := http_balancer.NewBalancer()
+			defer balancer.Close()
+			balancer.Update("backend", "primary-1.backend.com")
+			balancer.Update("backend-shadow", "shadow.backend.com")
+			shadow, _ := url.Parse("https://shadow.backend.com")
+			transport := &mirroringTransport{shadows: make(chan *shadowCall, 1)}
+			client := httpwares.TripperwareChain{
+				http_ctxtags.Tripperware(http_ctxtags.WithServiceName("backend")),
+				http_mirror.Tripperware(shadow, tcase.opts...),
+				http_balancer.Tripperware(balancer),
+			}.WrapClient(&http.Client{Transport: transport})
+			req, _ := http.NewRequest("GET", "http://backend/some/path", nil)
+			resp, err := client.Do(req)
+			require.NoError(t, err, "call shouldn't fail")
+			assert.Equal(t, "primary-1.backend.com", resp.Request.URL.Host, "the primary request must be balanced")
+			select {
+			case shadow := <-transport.shadows:
+				assert.Equal(t, "https://shadow.backend.com/some/path", shadow.req.URL.String(), "the shadow request must not be sent to the primary endpoints")
+				assert.Equal(t, tcase.expectedService, shadow.tags[http_ctxtags.TagForCallService])
+				assert.Equal(t, tcase.expectedEndpoint, shadow.tags[http_balancer.TagForEndpoint])
+			case <-time.After(time.Second):
+				t.Fatalf("the request must be mirrored")
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+/*
+`http_prometheus` provides client and server side reporting of HTTP stats to Prometheus.
+
+Server-side Monitoring
+
+The server-side `Middleware` exports request counts, latency histograms and request/response size histograms. All of
+them are broken down by `http_ctxtags` handler group and handler name, as well as the HTTP method and response code.
+As such, the middleware needs to be placed *after* `http_ctxtags.Middleware` in the chain, and handler names should be
+set using `http_ctxtags.HandlerName`.
+
+The metrics exported are:
+
+	http_server_requests_total{handler_group, handler_name, method, code}
+	http_server_request_duration_seconds{handler_group, handler_name, method, code}
+	http_server_request_size_bytes{handler_group, handler_name, method, code}
+	http_server_response_size_bytes{handler_group, handler_name, method, code}
+
+Client-side Monitoring
+
+The client-side `Tripperware` exports outbound request counts, latency histograms, in-flight gauges and connectivity
+error counters. They are broken down by the `http_ctxtags` service name (`http.call.service`), method and response code.
+The tripperware needs to be placed *after* `http_ctxtags.Tripperware` in the chain.
+
+Requests that failed without a response are counted with the "error" code, and additionally in the connectivity errors
+counter with an `error` label that distinguishes between "dns", "dial", "tls", "timeout", "canceled" and "other"
+failures. This allows dashboards to tell network failures apart from 5xx responses.
+
+The metrics exported are:
+
+	http_client_requests_total{service, method, code}
+	http_client_request_duration_seconds{service, method, code}
+	http_client_requests_in_flight{service, method}
+	http_client_connectivity_errors_total{service, method, error}
+
+Registering Metrics
+
+By default all metrics are registered in the `prometheus.DefaultRegisterer`, which can be changed with `WithRegisterer`.
+*/
+package http_prometheus
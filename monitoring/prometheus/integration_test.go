@@ -0,0 +1,169 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_prometheus_test
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/monitoring/prometheus"
+	"github.com/mwitkow/go-httpwares/tags"
+	"github.com/mwitkow/go-httpwares/testing"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestPrometheusMiddlewareSuite(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	s := &PrometheusMiddlewareSuite{
+		registry: registry,
+		WaresTestSuite: &httpwares_testing.WaresTestSuite{
+			Handler: http_ctxtags.HandlerName("ping")(httpwares_testing.PingBackHandler(httpwares_testing.DefaultPingBackStatusCode)),
+			ServerMiddleware: []httpwares.Middleware{
+				http_ctxtags.Middleware("pinger"),
+				http_prometheus.Middleware(http_prometheus.WithRegisterer(registry)),
+			},
+		},
+	}
+	suite.Run(t, s)
+}
+
+type PrometheusMiddlewareSuite struct {
+	*httpwares_testing.WaresTestSuite
+	registry *prometheus.Registry
+}
+
+func (s *PrometheusMiddlewareSuite) TestCountsAndSizesAreRecorded() {
+	before := sampleCount(s.T(), s.registry, "http_server_requests_total", "pinger", "ping", "POST", "201")
+	req, _ := http.NewRequest("POST", "https://something.local/someurl", strings.NewReader("some body"))
+	resp, err := s.NewClient().Do(req.WithContext(s.SimpleCtx()))
+	require.NoError(s.T(), err, "call shouldn't fail")
+	resp.Body.Close()
+	assert.EqualValues(s.T(), before+1, sampleCount(s.T(), s.registry, "http_server_requests_total", "pinger", "ping", "POST", "201"), "request must be counted")
+	assert.EqualValues(s.T(), before+1, sampleCount(s.T(), s.registry, "http_server_request_duration_seconds", "pinger", "ping", "POST", "201"), "latency must be observed")
+	assert.NotZero(s.T(), sampleSum(s.T(), s.registry, "http_server_request_size_bytes", "pinger", "ping", "POST", "201"), "request size must be observed")
+	assert.NotZero(s.T(), sampleSum(s.T(), s.registry, "http_server_response_size_bytes", "pinger", "ping", "POST", "201"), "response size must be observed")
+}
+
+func (s *PrometheusMiddlewareSuite) TestStatusCodeIsALabel() {
+	req, _ := http.NewRequest("GET", "https://something.local/someurl?code=503", nil)
+	resp, err := s.NewClient().Do(req.WithContext(s.SimpleCtx()))
+	require.NoError(s.T(), err, "call shouldn't fail")
+	resp.Body.Close()
+	assert.EqualValues(s.T(), 1, sampleCount(s.T(), s.registry, "http_server_requests_total", "pinger", "ping", "GET", "503"), "error code must be a label")
+}
+
+func findMetric(t *testing.T, g prometheus.Gatherer, name string, labelValues ...string) *dto.Metric {
+	families, err := g.Gather()
+	require.NoError(t, err, "gathering metrics must not fail")
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			values := []string{}
+			for _, lp := range m.GetLabel() {
+				values = append(values, lp.GetValue())
+			}
+			if containsAll(values, labelValues) {
+				return m
+			}
+		}
+	}
+	return nil
+}
+
+func containsAll(haystack []string, needles []string) bool {
+	for _, n := range needles {
+		found := false
+		for _, h := range haystack {
+			if h == n {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func sampleCount(t *testing.T, g prometheus.Gatherer, name string, labelValues ...string) uint64 {
+	m := findMetric(t, g, name, labelValues...)
+	switch {
+	case m == nil:
+		return 0
+	case m.Counter != nil:
+		return uint64(m.Counter.GetValue())
+	case m.Histogram != nil:
+		return m.Histogram.GetSampleCount()
+	}
+	return 0
+}
+
+func sampleSum(t *testing.T, g prometheus.Gatherer, name string, labelValues ...string) float64 {
+	m := findMetric(t, g, name, labelValues...)
+	if m == nil || m.Histogram == nil {
+		return 0
+	}
+	return m.Histogram.GetSampleSum()
+}
+
+func TestPrometheusTripperwareSuite(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	s := &PrometheusTripperwareSuite{
+		registry: registry,
+		WaresTestSuite: &httpwares_testing.WaresTestSuite{
+			ClientTripperware: httpwares.TripperwareChain{
+				http_ctxtags.Tripperware(http_ctxtags.WithServiceName("pinger")),
+				http_prometheus.Tripperware(http_prometheus.WithRegisterer(registry)),
+			},
+		},
+	}
+	suite.Run(t, s)
+}
+
+type PrometheusTripperwareSuite struct {
+	*httpwares_testing.WaresTestSuite
+	registry *prometheus.Registry
+}
+
+func (s *PrometheusTripperwareSuite) TestResponsesAreCountedByService() {
+	req, _ := http.NewRequest("GET", "https://something.local/someurl?code=502", nil)
+	resp, err := s.NewClient().Do(req.WithContext(s.SimpleCtx()))
+	require.NoError(s.T(), err, "call shouldn't fail")
+	resp.Body.Close()
+	assert.EqualValues(s.T(), 1, sampleCount(s.T(), s.registry, "http_client_requests_total", "pinger", "GET", "502"), "request must be counted")
+	assert.EqualValues(s.T(), 1, sampleCount(s.T(), s.registry, "http_client_request_duration_seconds", "pinger", "GET", "502"), "latency must be observed")
+	assert.Zero(s.T(), gaugeValue(s.T(), s.registry, "http_client_requests_in_flight", "pinger", "GET"), "no requests should be in flight")
+}
+
+func (s *PrometheusTripperwareSuite) TestConnectivityErrorsAreClassified() {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(s.T(), err, "must be able to allocate a port")
+	closedAddr := listener.Addr().String()
+	listener.Close()
+
+	client := s.ClientTripperware.WrapClient(&http.Client{})
+	req, _ := http.NewRequest("GET", "http://"+closedAddr+"/someurl", nil)
+	_, err = client.Do(req.WithContext(s.SimpleCtx()))
+	require.Error(s.T(), err, "call to a closed port must fail")
+	assert.EqualValues(s.T(), 1, sampleCount(s.T(), s.registry, "http_client_connectivity_errors_total", "pinger", "GET", http_prometheus.ErrorClassDial), "dial error must be counted")
+	assert.EqualValues(s.T(), 1, sampleCount(s.T(), s.registry, "http_client_requests_total", "pinger", "GET", "error"), "failed request must be counted")
+}
+
+func gaugeValue(t *testing.T, g prometheus.Gatherer, name string, labelValues ...string) float64 {
+	m := findMetric(t, g, name, labelValues...)
+	if m == nil || m.Gauge == nil {
+		return 0
+	}
+	return m.Gauge.GetValue()
+}
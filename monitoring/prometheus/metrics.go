@@ -0,0 +1,29 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_prometheus
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// registerOrExisting registers the collector, or returns the equivalent one that has been registered before.
+//
+// This allows for multiple wares to be constructed against the same registerer.
+func registerOrExisting(r prometheus.Registerer, c prometheus.Collector) prometheus.Collector {
+	if err := r.Register(c); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector
+		}
+		panic(err)
+	}
+	return c
+}
+
+func registerCounterVec(r prometheus.Registerer, opts prometheus.CounterOpts, labels []string) *prometheus.CounterVec {
+	return registerOrExisting(r, prometheus.NewCounterVec(opts, labels)).(*prometheus.CounterVec)
+}
+
+func registerHistogramVec(r prometheus.Registerer, opts prometheus.HistogramOpts, labels []string) *prometheus.HistogramVec {
+	return registerOrExisting(r, prometheus.NewHistogramVec(opts, labels)).(*prometheus.HistogramVec)
+}
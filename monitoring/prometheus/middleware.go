@@ -0,0 +1,105 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_prometheus
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/tags"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	serverLabels = []string{"handler_group", "handler_name", "method", "code"}
+)
+
+// Middleware returns a http.Handler middleware that exports request metrics to Prometheus.
+//
+// The metrics are broken down by handler group and handler name (taken from `http_ctxtags`), method and status code.
+// The status code and response sizes are read from the `httpwares.WrappedResponseWriter`.
+func Middleware(opts ...Option) httpwares.Middleware {
+	o := evaluateOptions(opts)
+	requestsTotal := registerCounterVec(o.registerer, prometheus.CounterOpts{
+		Name: "http_server_requests_total",
+		Help: "Total number of requests completed on the server.",
+	}, serverLabels)
+	requestDuration := registerHistogramVec(o.registerer, prometheus.HistogramOpts{
+		Name:    "http_server_request_duration_seconds",
+		Help:    "Latency of requests handled by the server, until the handler returned.",
+		Buckets: o.latencyBuckets,
+	}, serverLabels)
+	requestSize := registerHistogramVec(o.registerer, prometheus.HistogramOpts{
+		Name:    "http_server_request_size_bytes",
+		Help:    "Size of request bodies received by the server.",
+		Buckets: o.sizeBuckets,
+	}, serverLabels)
+	responseSize := registerHistogramVec(o.registerer, prometheus.HistogramOpts{
+		Name:    "http_server_response_size_bytes",
+		Help:    "Size of response bodies sent by the server.",
+		Buckets: o.sizeBuckets,
+	}, serverLabels)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			newReq := req
+			var counter *countingReadCloser
+			if req.ContentLength < 0 && req.Body != nil {
+				// Size of streamed bodies is only known once the handler read them.
+				counter = &countingReadCloser{ReadCloser: req.Body}
+				newReq = req.WithContext(req.Context()) // make a copy.
+				newReq.Body = counter
+			}
+			wrappedResp := httpwares.WrapResponseWriter(resp)
+			startTime := time.Now()
+			next.ServeHTTP(wrappedResp, newReq)
+			elapsed := time.Since(startTime)
+
+			// Handler names are usually set deeper in the chain, so only read the tags here.
+			lvs := serverLabelValues(newReq, wrappedResp.StatusCode())
+			requestsTotal.WithLabelValues(lvs...).Inc()
+			requestDuration.WithLabelValues(lvs...).Observe(elapsed.Seconds())
+			reqSize := req.ContentLength
+			if counter != nil {
+				reqSize = counter.bytes
+			}
+			requestSize.WithLabelValues(lvs...).Observe(float64(reqSize))
+			responseSize.WithLabelValues(lvs...).Observe(float64(wrappedResp.MessageLength()))
+		})
+	}
+}
+
+func serverLabelValues(req *http.Request, code int) []string {
+	if code == 0 {
+		// The handler didn't write anything, net/http will return an empty 200.
+		code = http.StatusOK
+	}
+	vals := http_ctxtags.ExtractInbound(req).Values()
+	return []string{
+		tagOrUnknown(vals, http_ctxtags.TagForHandlerGroup),
+		tagOrUnknown(vals, http_ctxtags.TagForHandlerName),
+		req.Method,
+		strconv.Itoa(code),
+	}
+}
+
+func tagOrUnknown(vals map[string]interface{}, key string) string {
+	if val, ok := vals[key].(string); ok && val != "" {
+		return val
+	}
+	return "unknown"
+}
+
+type countingReadCloser struct {
+	io.ReadCloser
+	bytes int64
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.bytes += int64(n)
+	return n, err
+}
@@ -0,0 +1,66 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_prometheus
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// DefaultSizeBuckets are the default buckets used for request and response size histograms, in bytes.
+	DefaultSizeBuckets = prometheus.ExponentialBuckets(64, 4, 10)
+
+	defaultOptions = &options{
+		registerer:     nil,
+		latencyBuckets: prometheus.DefBuckets,
+		sizeBuckets:    DefaultSizeBuckets,
+	}
+)
+
+type options struct {
+	registerer     prometheus.Registerer
+	latencyBuckets []float64
+	sizeBuckets    []float64
+}
+
+func evaluateOptions(opts []Option) *options {
+	optCopy := &options{}
+	*optCopy = *defaultOptions
+	for _, o := range opts {
+		o(optCopy)
+	}
+	if optCopy.registerer == nil {
+		optCopy.registerer = prometheus.DefaultRegisterer
+	}
+	return optCopy
+}
+
+type Option func(*options)
+
+// WithRegisterer sets the `prometheus.Registerer` the metrics will be registered in.
+//
+// By default `prometheus.DefaultRegisterer` is used.
+func WithRegisterer(r prometheus.Registerer) Option {
+	return func(o *options) {
+		o.registerer = r
+	}
+}
+
+// WithLatencyBuckets customizes the buckets (in seconds) of the latency histograms.
+//
+// By default `prometheus.DefBuckets` are used.
+func WithLatencyBuckets(buckets []float64) Option {
+	return func(o *options) {
+		o.latencyBuckets = buckets
+	}
+}
+
+// WithSizeBuckets customizes the buckets (in bytes) of the request and response size histograms.
+//
+// By default `DefaultSizeBuckets` are used.
+func WithSizeBuckets(buckets []float64) Option {
+	return func(o *options) {
+		o.sizeBuckets = buckets
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_prometheus
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/internal"
+	"github.com/mwitkow/go-httpwares/tags"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// ErrorClassDns is the `error` label value for failures in resolving the host name.
+	ErrorClassDns = "dns"
+	// ErrorClassDial is the `error` label value for failures in establishing the TCP connection.
+	ErrorClassDial = "dial"
+	// ErrorClassTls is the `error` label value for failed TLS handshakes and certificate verification.
+	ErrorClassTls = "tls"
+	// ErrorClassTimeout is the `error` label value for requests that timed out, including context deadlines.
+	ErrorClassTimeout = "timeout"
+	// ErrorClassCanceled is the `error` label value for requests that got canceled through their context.
+	ErrorClassCanceled = "canceled"
+	// ErrorClassOther is the `error` label value for all other errors returned from the RoundTripper.
+	ErrorClassOther = "other"
+
+	// codeForError is the `code` label value for requests that failed without a response.
+	codeForError = "error"
+)
+
+// Tripperware returns a piece of client-side Tripperware that exports outbound request metrics to Prometheus.
+//
+// The metrics are broken down by the `http.call.service` tag from `http_ctxtags`, method and status code. Requests that
+// failed without a response are reported with the "error" code, and are counted in a separate counter broken down by
+// the class of the error (see `ErrorClass*` consts), allowing to tell connectivity problems apart from bad responses.
+// As such, this needs to be placed *after* `http_ctxtags.Tripperware` in the chain.
+func Tripperware(opts ...Option) httpwares.Tripperware {
+	o := evaluateOptions(opts)
+	requestsTotal := registerCounterVec(o.registerer, prometheus.CounterOpts{
+		Name: "http_client_requests_total",
+		Help: "Total number of requests completed by the client, including failed ones.",
+	}, []string{"service", "method", "code"})
+	requestDuration := registerHistogramVec(o.registerer, prometheus.HistogramOpts{
+		Name:    "http_client_request_duration_seconds",
+		Help:    "Latency of requests made by the client, until response headers were received.",
+		Buckets: o.latencyBuckets,
+	}, []string{"service", "method", "code"})
+	inFlight := registerOrExisting(o.registerer, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "http_client_requests_in_flight",
+		Help: "Number of requests currently made by the client that haven't received response headers.",
+	}, []string{"service", "method"})).(*prometheus.GaugeVec)
+	errorsTotal := registerCounterVec(o.registerer, prometheus.CounterOpts{
+		Name: "http_client_connectivity_errors_total",
+		Help: "Total number of requests made by the client that failed without a response, by class of error.",
+	}, []string{"service", "method", "error"})
+	return func(next http.RoundTripper) http.RoundTripper {
+		return httpwares.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			service := http_ctxtags.ServiceName(req)
+			inFlightGauge := inFlight.WithLabelValues(service, req.Method)
+			inFlightGauge.Inc()
+			startTime := time.Now()
+			resp, err := next.RoundTrip(req)
+			elapsed := time.Since(startTime)
+			inFlightGauge.Dec()
+
+			code := codeForError
+			if err != nil {
+				errorsTotal.WithLabelValues(service, req.Method, ClassifyError(err)).Inc()
+			} else {
+				code = strconv.Itoa(resp.StatusCode)
+			}
+			requestsTotal.WithLabelValues(service, req.Method, code).Inc()
+			requestDuration.WithLabelValues(service, req.Method, code).Observe(elapsed.Seconds())
+			return resp, err
+		})
+	}
+}
+
+// ClassifyError returns the class of a connectivity error returned by a http.RoundTripper.
+//
+// It is the value of the `error` label of the client-side connectivity errors counter.
+func ClassifyError(err error) string {
+	err = http_internal.UnwrapURLError(err)
+	if err == context.Canceled {
+		return ErrorClassCanceled
+	} else if err == context.DeadlineExceeded {
+		return ErrorClassTimeout
+	}
+	switch e := err.(type) {
+	case *net.OpError:
+		if _, ok := e.Err.(*net.DNSError); ok {
+			return ErrorClassDns
+		} else if e.Timeout() {
+			return ErrorClassTimeout
+		} else if e.Op == "dial" {
+			return ErrorClassDial
+		}
+		return ErrorClassOther
+	case *net.DNSError:
+		return ErrorClassDns
+	case x509.UnknownAuthorityError, x509.HostnameError, x509.CertificateInvalidError:
+		return ErrorClassTls
+	case net.Error:
+		if e.Timeout() {
+			return ErrorClassTimeout
+		}
+	}
+	// Handshake errors of crypto/tls are mostly plain strings.
+	if strings.HasPrefix(err.Error(), "tls:") || strings.Contains(err.Error(), "x509:") {
+		return ErrorClassTls
+	}
+	return ErrorClassOther
+}
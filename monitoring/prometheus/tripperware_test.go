@@ -0,0 +1,75 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_prometheus_test
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/mwitkow/go-httpwares/monitoring/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeTimeoutError struct{}
+
+func (fakeTimeoutError) Error() string   { return "i/o timeout" }
+func (fakeTimeoutError) Timeout() bool   { return true }
+func (fakeTimeoutError) Temporary() bool { return true }
+
+func TestClassifyError(t *testing.T) {
+	for _, tcase := range []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{
+			name:     "dns",
+			err:      &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "whatever.invalid"}},
+			expected: http_prometheus.ErrorClassDns,
+		},
+		{
+			name:     "dial",
+			err:      &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")},
+			expected: http_prometheus.ErrorClassDial,
+		},
+		{
+			name:     "dial_timeout",
+			err:      &net.OpError{Op: "dial", Net: "tcp", Err: fakeTimeoutError{}},
+			expected: http_prometheus.ErrorClassTimeout,
+		},
+		{
+			name:     "tls_certificate",
+			err:      x509.UnknownAuthorityError{},
+			expected: http_prometheus.ErrorClassTls,
+		},
+		{
+			name:     "tls_handshake",
+			err:      errors.New("tls: handshake failure"),
+			expected: http_prometheus.ErrorClassTls,
+		},
+		{
+			name:     "deadline",
+			err:      context.DeadlineExceeded,
+			expected: http_prometheus.ErrorClassTimeout,
+		},
+		{
+			name:     "canceled_in_url_error",
+			err:      &url.Error{Op: "Get", URL: "http://whatever", Err: context.Canceled},
+			expected: http_prometheus.ErrorClassCanceled,
+		},
+		{
+			name:     "other",
+			err:      errors.New("something else"),
+			expected: http_prometheus.ErrorClassOther,
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			assert.Equal(t, tcase.expected, http_prometheus.ClassifyError(tcase.err), "wrong error class")
+		})
+	}
+}
@@ -0,0 +1,25 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+/*
+`http_ratelimit` limits the rate of HTTP requests with token buckets.
+
+Client-side Rate Limiting
+
+The client-side `Tripperware` keeps a token bucket for each service, identified by the `http.call.service` tag set by
+`http_ctxtags.Tripperware`, or by the host of the request if the tag is not set. The limits of the buckets are kept in
+`Limits`, which can be changed at runtime, e.g. when the quota of a partner changes, without rebuilding the client.
+
+In the default `ModeWait` requests over the limit block until a token is free. If the wait would last past the deadline
+of the request's context, a `*LimitedError` is returned straight away. In `ModeReject` all requests over the limit fail
+immediately with a `*LimitedError`.
+
+Server-side Rate Limiting
+
+The server-side `Middleware` limits inbound requests by a key built from their `http_ctxtags` with `KeyByTags`, e.g.
+the client IP in `peer.address` and the handler group, or by a custom `KeyFunc`. The token buckets are kept in a
+`Store`, with `MemoryStore` keeping them in memory for a bounded number of recently used keys. Requests over the limit
+are rejected with 429 and a `Retry-After` header, and all responses describe the limit in the `RateLimit-Limit`,
+`RateLimit-Remaining` and `RateLimit-Reset` headers.
+*/
+package http_ratelimit
@@ -0,0 +1,147 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// minBucketsToSweep is the number of buckets below which idle buckets are not looked for.
+const minBucketsToSweep = 64
+
+// Limits keeps the rate limits of services, and the token buckets enforcing them.
+//
+// The limits can be changed at runtime and take effect for the buckets immediately. A single Limits is meant to be shared
+// between Tripperwares, and is safe for concurrent use.
+//
+// Buckets of services that weren't used for long enough to fill up again are dropped, as they are the same as new ones.
+// As such the number of buckets kept is bounded by (twice) the number of services used recently, except for services
+// limited to a zero rate, whose buckets are kept forever.
+type Limits struct {
+	mu           sync.Mutex
+	defaultLimit limit
+	limits       map[string]limit
+	buckets      map[string]*bucket
+	// sweepAt is the number of buckets at which idle ones are dropped.
+	sweepAt int
+}
+
+type bucket struct {
+	*rate.Limiter
+	// lastUsed is the time the last reservation made from the bucket takes effect.
+	lastUsed time.Time
+}
+
+type limit struct {
+	rate  rate.Limit
+	burst int
+}
+
+// NewLimits creates new rate limits, with the default limit for all services that don't have their own one set.
+//
+// The rate is given in requests per second, with `rate.Inf` meaning no limit, and burst is the number of requests that
+// can be made at once.
+func NewLimits(defaultRate rate.Limit, defaultBurst int) *Limits {
+	return &Limits{
+		defaultLimit: limit{rate: defaultRate, burst: defaultBurst},
+		limits:       make(map[string]limit),
+		buckets:      make(map[string]*bucket),
+		sweepAt:      minBucketsToSweep,
+	}
+}
+
+// Set sets the limit of the given service.
+func (l *Limits) Set(service string, r rate.Limit, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits[service] = limit{rate: r, burst: burst}
+	if bucket, ok := l.buckets[service]; ok {
+		bucket.SetLimit(r)
+		bucket.SetBurst(burst)
+	}
+}
+
+// SetDefault sets the limit of all services that don't have their own one set.
+func (l *Limits) SetDefault(r rate.Limit, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.defaultLimit = limit{rate: r, burst: burst}
+	for service, bucket := range l.buckets {
+		if _, ok := l.limits[service]; !ok {
+			bucket.SetLimit(r)
+			bucket.SetBurst(burst)
+		}
+	}
+}
+
+// Reset removes the limit of the given service, so that the default one applies again.
+func (l *Limits) Reset(service string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.limits, service)
+	if bucket, ok := l.buckets[service]; ok {
+		bucket.SetLimit(l.defaultLimit.rate)
+		bucket.SetBurst(l.defaultLimit.burst)
+	}
+}
+
+// Len returns the number of services the buckets are kept for.
+func (l *Limits) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+// reserve reserves a token from the bucket of the service.
+func (l *Limits) reserve(service string, now time.Time) *rate.Reservation {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[service]
+	if !ok {
+		if len(l.buckets) >= l.sweepAt {
+			l.sweepLocked(now)
+		}
+		lim, ok := l.limits[service]
+		if !ok {
+			lim = l.defaultLimit
+		}
+		b = &bucket{Limiter: rate.NewLimiter(lim.rate, lim.burst)}
+		l.buckets[service] = b
+	}
+	reservation := b.ReserveN(now, 1)
+	if reservation.OK() {
+		if actAt := now.Add(reservation.DelayFrom(now)); actAt.After(b.lastUsed) {
+			b.lastUsed = actAt
+		}
+	}
+	return reservation
+}
+
+// sweepLocked drops the buckets that are full again, so that the buckets of services no longer used don't pile up.
+func (l *Limits) sweepLocked(now time.Time) {
+	for service, b := range l.buckets {
+		if b.isFull(now) {
+			delete(l.buckets, service)
+		}
+	}
+	l.sweepAt = 2 * len(l.buckets)
+	if l.sweepAt < minBucketsToSweep {
+		l.sweepAt = minBucketsToSweep
+	}
+}
+
+// isFull checks whether the bucket had the time to fill up since it was last used.
+func (b *bucket) isFull(now time.Time) bool {
+	if b.Limit() == rate.Inf {
+		return true
+	}
+	if b.Limit() <= 0 {
+		return false // it never fills up again.
+	}
+	refill := time.Duration(float64(b.Burst()) / float64(b.Limit()) * float64(time.Second))
+	return now.Sub(b.lastUsed) >= refill
+}
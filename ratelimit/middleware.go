@@ -0,0 +1,84 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/tags"
+)
+
+const (
+	// TagForRateLimited is a string naming the ctxtag set on inbound requests rejected by the rate limit.
+	TagForRateLimited = "http.ratelimit.limited"
+)
+
+// KeyFunc returns the key the limit of an inbound request is kept under. Requests with an empty key are not limited.
+type KeyFunc func(req *http.Request) string
+
+// KeyByTags returns a KeyFunc building the key from the values of the given inbound tags.
+//
+// For example, `KeyByTags("peer.address", http_ctxtags.TagForHandlerGroup)` limits each client IP separately in each
+// handler group. Requests with none of the tags set are not limited.
+func KeyByTags(tagNames ...string) KeyFunc {
+	return func(req *http.Request) string {
+		values := http_ctxtags.ExtractInbound(req).Values()
+		parts := make([]string, len(tagNames))
+		found := false
+		for i, name := range tagNames {
+			if value, ok := values[name]; ok {
+				parts[i] = fmt.Sprint(value)
+				found = true
+			}
+		}
+		if !found {
+			return ""
+		}
+		return strings.Join(parts, "|")
+	}
+}
+
+// Middleware returns a http.Handler middleware that limits the rate of inbound requests.
+//
+// The limit of every request is kept under the key returned by the `KeyFunc` (see `WithKeyFunc`), by default the
+// `peer.address` tag. It needs to be placed after `http_ctxtags.Middleware` in the chain. Requests over the limit are
+// rejected with 429. All responses carry the `RateLimit-Limit`, `RateLimit-Remaining` and `RateLimit-Reset` headers
+// describing the limit, and rejected ones the `Retry-After` header.
+func Middleware(store Store, opts ...MiddlewareOption) httpwares.Middleware {
+	o := evaluateMiddlewareOptions(opts)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			key := o.keyFunc(req)
+			if key == "" {
+				next.ServeHTTP(resp, req)
+				return
+			}
+			res := store.Take(key, time.Now())
+			header := resp.Header()
+			header.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			header.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			header.Set("RateLimit-Reset", durationToSeconds(res.Reset))
+			if !res.Allowed {
+				http_ctxtags.ExtractInbound(req).Set(TagForRateLimited, true)
+				if res.RetryAfter > 0 {
+					header.Set("Retry-After", durationToSeconds(res.RetryAfter))
+				}
+				http.Error(resp, "rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(resp, req)
+		})
+	}
+}
+
+// durationToSeconds formats the duration as whole seconds for headers, rounding up.
+func durationToSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,105 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_ratelimit_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/ratelimit"
+	"github.com/mwitkow/go-httpwares/tags"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func rateLimitedHandler(group string, store http_ratelimit.Store, opts ...http_ratelimit.MiddlewareOption) (http.Handler, *bool) {
+	limited := false
+	return httpwares.MiddlewareChain{
+		http_ctxtags.Middleware(group),
+		func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+				next.ServeHTTP(resp, req)
+				limited = http_ctxtags.ExtractInbound(req).Has(http_ratelimit.TagForRateLimited)
+			})
+		},
+		http_ratelimit.Middleware(store, opts...),
+	}.ForgeFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(http.StatusOK)
+	}), &limited
+}
+
+func serveFrom(handler http.Handler, remoteAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/someurl", nil)
+	req.RemoteAddr = remoteAddr
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestMiddlewareLimitsByPeerAddress(t *testing.T) {
+	handler, limited := rateLimitedHandler("api", http_ratelimit.NewMemoryStore(0.5, 2, 100))
+	resp := serveFrom(handler, "10.0.0.1:1234")
+	assert.Equal(t, http.StatusOK, resp.Code, "requests within the burst must be handled")
+	assert.Equal(t, "2", resp.Header().Get("RateLimit-Limit"), "the limit must be the burst")
+	assert.Equal(t, "1", resp.Header().Get("RateLimit-Remaining"), "the remaining requests must be sent")
+	assert.Equal(t, "2", resp.Header().Get("RateLimit-Reset"), "the time to refill the bucket must be sent")
+	assert.Empty(t, resp.Header().Get("Retry-After"), "handled requests must not have a retry after")
+
+	serveFrom(handler, "10.0.0.1:2345")
+	resp = serveFrom(handler, "10.0.0.1:3456")
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code, "requests over the limit must be rejected")
+	assert.Equal(t, "0", resp.Header().Get("RateLimit-Remaining"), "no requests must remain")
+	assert.Equal(t, "2", resp.Header().Get("Retry-After"), "the time until a token is free must be sent")
+	assert.True(t, *limited, "rejected requests must be tagged")
+
+	resp = serveFrom(handler, "10.0.0.2:1234")
+	assert.Equal(t, http.StatusOK, resp.Code, "other clients must have their own limit")
+	assert.False(t, *limited, "handled requests must not be tagged")
+}
+
+func TestMiddlewareLimitsByTagCombination(t *testing.T) {
+	store := http_ratelimit.NewMemoryStore(rate.Every(time.Hour), 1, 100)
+	keyFunc := http_ratelimit.WithKeyFunc(http_ratelimit.KeyByTags("peer.address", http_ctxtags.TagForHandlerGroup))
+	apiHandler, _ := rateLimitedHandler("api", store, keyFunc)
+	adminHandler, _ := rateLimitedHandler("admin", store, keyFunc)
+	assert.Equal(t, http.StatusOK, serveFrom(apiHandler, "10.0.0.1:1234").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serveFrom(apiHandler, "10.0.0.1:1234").Code, "the limit must be kept per client and group")
+	assert.Equal(t, http.StatusOK, serveFrom(adminHandler, "10.0.0.1:1234").Code, "other groups must have their own limit")
+	assert.Equal(t, 2, store.Len(), "buckets must be kept per key")
+}
+
+func TestMiddlewareSkipsEmptyKeys(t *testing.T) {
+	handler, _ := rateLimitedHandler("api", http_ratelimit.NewMemoryStore(0, 0, 100), http_ratelimit.WithKeyFunc(func(*http.Request) string {
+		return ""
+	}))
+	resp := serveFrom(handler, "10.0.0.1:1234")
+	assert.Equal(t, http.StatusOK, resp.Code, "requests without a key must not be limited")
+	assert.Empty(t, resp.Header().Get("RateLimit-Limit"), "requests without a key must not have limit headers")
+}
+
+func TestMemoryStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	store := http_ratelimit.NewMemoryStore(rate.Every(time.Hour), 1, 2)
+	now := time.Now()
+	require.True(t, store.Take("a", now).Allowed)
+	require.True(t, store.Take("b", now).Allowed)
+	assert.False(t, store.Take("a", now).Allowed, "the bucket of a must be empty")
+	require.True(t, store.Take("c", now).Allowed)
+	assert.Equal(t, 2, store.Len(), "the number of buckets must be bounded")
+	assert.False(t, store.Take("a", now).Allowed, "recently used buckets must be kept")
+	assert.True(t, store.Take("b", now).Allowed, "the least recently used bucket must be forgotten")
+}
+
+func TestMemoryStoreRefillsOverTime(t *testing.T) {
+	store := http_ratelimit.NewMemoryStore(10, 1, 0)
+	now := time.Now()
+	require.True(t, store.Take("a", now).Allowed)
+	res := store.Take("a", now.Add(50*time.Millisecond))
+	assert.False(t, res.Allowed, "the bucket must not be refilled yet")
+	assert.Equal(t, 50*time.Millisecond, res.RetryAfter, "the retry after must be the time to refill a token")
+	assert.True(t, store.Take("a", now.Add(100*time.Millisecond)).Allowed, "the bucket must be refilled")
+}
@@ -0,0 +1,71 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_ratelimit
+
+var (
+	defaultOptions = &options{
+		mode: ModeWait,
+	}
+	defaultMiddlewareOptions = &middlewareOptions{
+		keyFunc: KeyByTags("peer.address"),
+	}
+)
+
+type options struct {
+	mode Mode
+}
+
+func evaluateOptions(opts []Option) *options {
+	optCopy := &options{}
+	*optCopy = *defaultOptions
+	for _, o := range opts {
+		o(optCopy)
+	}
+	return optCopy
+}
+
+// Option configures the client-side Tripperware.
+type Option func(*options)
+
+type middlewareOptions struct {
+	keyFunc KeyFunc
+}
+
+func evaluateMiddlewareOptions(opts []MiddlewareOption) *middlewareOptions {
+	optCopy := &middlewareOptions{}
+	*optCopy = *defaultMiddlewareOptions
+	for _, o := range opts {
+		o(optCopy)
+	}
+	return optCopy
+}
+
+// MiddlewareOption configures the server-side Middleware.
+type MiddlewareOption func(*middlewareOptions)
+
+// Mode decides what happens to requests over the limit.
+type Mode int
+
+const (
+	// ModeWait blocks requests until a token is free, or their context is done.
+	ModeWait Mode = iota
+	// ModeReject fails requests over the limit immediately.
+	ModeReject
+)
+
+// WithMode sets what happens to requests over the limit in the Tripperware, `ModeWait` by default.
+func WithMode(m Mode) Option {
+	return func(o *options) {
+		o.mode = m
+	}
+}
+
+// WithKeyFunc sets the function returning the key the limit of an inbound request is kept under in the Middleware.
+//
+// By default the limit is kept by the `peer.address` tag, i.e. for each client IP.
+func WithKeyFunc(f KeyFunc) MiddlewareOption {
+	return func(o *middlewareOptions) {
+		o.keyFunc = f
+	}
+}
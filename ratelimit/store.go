@@ -0,0 +1,121 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_ratelimit
+
+import (
+	"container/list"
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Store keeps the token buckets of the keys limited by the Middleware.
+//
+// Implementations can keep the buckets outside of the process, e.g. to share the limits between many servers.
+type Store interface {
+	// Take takes a token from the bucket of the given key, returning the state of the bucket after.
+	Take(key string, now time.Time) Result
+}
+
+// Result is the state of a token bucket after taking a token from it.
+type Result struct {
+	// Allowed is true if a token was taken and the request is within the limit.
+	Allowed bool
+	// Limit is the number of requests that can be made at once, the size of the bucket.
+	Limit int
+	// Remaining is the number of requests that can still be made at once.
+	Remaining int
+	// Reset is the time after which the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time after which a token would be free, or 0 if no request could ever be made.
+	RetryAfter time.Duration
+}
+
+// MemoryStore is an in-memory Store, keeping the buckets of at most a given number of keys.
+//
+// Once there are too many keys, the buckets of the least recently used ones are forgotten, and start full the next
+// time they're used. This bounds the memory used by limits on unbounded keys, such as client IPs.
+type MemoryStore struct {
+	mu      sync.Mutex
+	rate    rate.Limit
+	burst   int
+	maxKeys int
+	buckets map[string]*list.Element
+	lru     *list.List
+}
+
+type memoryBucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// NewMemoryStore creates a new in-memory Store with the same limit for all keys, keeping at most maxKeys buckets.
+//
+// The rate is given in requests per second, with `rate.Inf` meaning no limit, and burst is the number of requests that
+// can be made at once.
+func NewMemoryStore(r rate.Limit, burst int, maxKeys int) *MemoryStore {
+	return &MemoryStore{
+		rate:    r,
+		burst:   burst,
+		maxKeys: maxKeys,
+		buckets: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Len returns the number of keys the buckets are kept for.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.Len()
+}
+
+// Take implements Store.
+func (s *MemoryStore) Take(key string, now time.Time) Result {
+	if s.rate == rate.Inf {
+		return Result{Allowed: true, Limit: s.burst, Remaining: s.burst}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bucket := s.bucket(key, now)
+	if elapsed := now.Sub(bucket.last); elapsed > 0 {
+		bucket.tokens = math.Min(float64(s.burst), bucket.tokens+elapsed.Seconds()*float64(s.rate))
+		bucket.last = now
+	}
+	res := Result{Limit: s.burst}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		res.Allowed = true
+	} else if s.rate > 0 {
+		res.RetryAfter = s.durationFor(1 - bucket.tokens)
+	}
+	res.Remaining = int(bucket.tokens)
+	if s.rate > 0 {
+		res.Reset = s.durationFor(float64(s.burst) - bucket.tokens)
+	}
+	return res
+}
+
+func (s *MemoryStore) bucket(key string, now time.Time) *memoryBucket {
+	if elem, ok := s.buckets[key]; ok {
+		s.lru.MoveToFront(elem)
+		return elem.Value.(*memoryBucket)
+	}
+	bucket := &memoryBucket{key: key, tokens: float64(s.burst), last: now}
+	s.buckets[key] = s.lru.PushFront(bucket)
+	for s.maxKeys > 0 && s.lru.Len() > s.maxKeys {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.buckets, oldest.Value.(*memoryBucket).key)
+	}
+	return bucket
+}
+
+// durationFor returns the time it takes to refill the given number of tokens.
+func (s *MemoryStore) durationFor(tokens float64) time.Duration {
+	return time.Duration(tokens / float64(s.rate) * float64(time.Second))
+}
@@ -0,0 +1,76 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_ratelimit
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/internal"
+	"github.com/mwitkow/go-httpwares/tags"
+)
+
+const (
+	// TagForRateLimitWait is a string naming the ctxtag with the time in milliseconds a request waited for a token.
+	TagForRateLimitWait = "http.ratelimit.wait_ms"
+)
+
+// LimitedError is returned by the Tripperware for requests over the rate limit of a service.
+type LimitedError struct {
+	// Service is the name of the service (or the host) the limit is kept for.
+	Service string
+	// RetryAfter is the time after which a token would be free, or 0 if the request could never be made.
+	RetryAfter time.Duration
+}
+
+func (e *LimitedError) Error() string {
+	return fmt.Sprintf("http_ratelimit: rate limit for %v exceeded, retry after %v", e.Service, e.RetryAfter)
+}
+
+// IsLimitedError checks whether the error, possibly returned from `http.Client`, is caused by the rate limit.
+func IsLimitedError(err error) bool {
+	_, ok := http_internal.UnwrapURLError(err).(*LimitedError)
+	return ok
+}
+
+// Tripperware is client side HTTP ware that limits the rate of requests to each service.
+//
+// It needs to be placed after `http_ctxtags.Tripperware` in the chain for the limits to be kept by service name.
+func Tripperware(limits *Limits, opts ...Option) httpwares.Tripperware {
+	o := evaluateOptions(opts)
+	return func(next http.RoundTripper) http.RoundTripper {
+		return httpwares.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			service := http_ctxtags.ServiceName(req)
+			now := time.Now()
+			reservation := limits.reserve(service, now)
+			if !reservation.OK() {
+				return nil, &LimitedError{Service: service} // the burst is 0, no request can ever be made.
+			}
+			delay := reservation.DelayFrom(now)
+			if delay == 0 {
+				return next.RoundTrip(req)
+			}
+			if o.mode == ModeReject {
+				reservation.CancelAt(now)
+				return nil, &LimitedError{Service: service, RetryAfter: delay}
+			}
+			if deadline, ok := req.Context().Deadline(); ok && now.Add(delay).After(deadline) {
+				reservation.CancelAt(now)
+				return nil, &LimitedError{Service: service, RetryAfter: delay}
+			}
+			timer := time.NewTimer(delay)
+			defer timer.Stop()
+			select {
+			case <-req.Context().Done():
+				reservation.Cancel()
+				return nil, req.Context().Err()
+			case <-timer.C:
+			}
+			http_ctxtags.ExtractOutbound(req).Set(TagForRateLimitWait, http_internal.TimeDiffToMilliseconds(now))
+			return next.RoundTrip(req)
+		})
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_ratelimit_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/ratelimit"
+	"github.com/mwitkow/go-httpwares/tags"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func rateLimitedClient(limits *http_ratelimit.Limits, opts ...http_ratelimit.Option) *http.Client {
+	transport := httpwares.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("")), Request: req}, nil
+	})
+	return httpwares.TripperwareChain{
+		http_ctxtags.Tripperware(),
+		http_ratelimit.Tripperware(limits, opts...),
+	}.WrapClient(&http.Client{Transport: transport})
+}
+
+func get(client *http.Client, ctx context.Context, host string) error {
+	req, _ := http.NewRequest("GET", "http://"+host+"/someurl", nil)
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func TestRejectModeFailsOverLimit(t *testing.T) {
+	limits := http_ratelimit.NewLimits(rate.Inf, 1)
+	limits.Set("partner", rate.Every(time.Hour), 2)
+	client := rateLimitedClient(limits, http_ratelimit.WithMode(http_ratelimit.ModeReject))
+	for i := 0; i < 2; i++ {
+		require.NoError(t, get(client, context.Background(), "api.partner.com"), "requests within the burst must pass")
+	}
+	err := get(client, context.Background(), "api.partner.com")
+	require.Error(t, err, "requests over the limit must be rejected")
+	assert.True(t, http_ratelimit.IsLimitedError(err), "the error must be typed, got %v", err)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, get(client, context.Background(), "api.other.com"), "other services must use the default limit")
+	}
+}
+
+func TestWaitModeBlocksUntilTokenIsFree(t *testing.T) {
+	limits := http_ratelimit.NewLimits(rate.Every(50*time.Millisecond), 1)
+	client := rateLimitedClient(limits)
+	startTime := time.Now()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, get(client, context.Background(), "api.partner.com"), "requests must wait for tokens")
+	}
+	assert.True(t, time.Since(startTime) >= 100*time.Millisecond, "requests over the limit must wait")
+}
+
+func TestWaitModeFailsIfWaitExceedsDeadline(t *testing.T) {
+	limits := http_ratelimit.NewLimits(rate.Every(time.Hour), 1)
+	client := rateLimitedClient(limits)
+	require.NoError(t, get(client, context.Background(), "api.partner.com"), "the first request must pass")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	startTime := time.Now()
+	err := get(client, ctx, "api.partner.com")
+	assert.True(t, http_ratelimit.IsLimitedError(err), "the error must be typed, got %v", err)
+	assert.True(t, time.Since(startTime) < 500*time.Millisecond, "the request must not wait for the deadline")
+}
+
+func TestLimitsAreAdjustableAtRuntime(t *testing.T) {
+	limits := http_ratelimit.NewLimits(rate.Every(time.Hour), 1)
+	client := rateLimitedClient(limits, http_ratelimit.WithMode(http_ratelimit.ModeReject))
+	require.NoError(t, get(client, context.Background(), "api.partner.com"), "the first request must pass")
+	require.Error(t, get(client, context.Background(), "api.partner.com"), "the second request must be rejected")
+	limits.Set("partner", rate.Inf, 1)
+	assert.NoError(t, get(client, context.Background(), "api.partner.com"), "the new limit must apply immediately")
+	limits.Reset("partner")
+	limits.SetDefault(rate.Every(time.Hour), 0)
+	assert.Error(t, get(client, context.Background(), "api.partner.com"), "the new default must apply after a reset")
+}
+
+func TestLimitsDropIdleBuckets(t *testing.T) {
+	limits := http_ratelimit.NewLimits(rate.Every(time.Millisecond), 1)
+	client := rateLimitedClient(limits)
+	for i := 0; i < 64; i++ {
+		require.NoError(t, get(client, context.Background(), fmt.Sprintf("api.idle-%d.com", i)))
+	}
+	assert.Equal(t, 64, limits.Len(), "buckets must be kept per service")
+	time.Sleep(20 * time.Millisecond) // all the buckets fill up again.
+	for i := 0; i < 64; i++ {
+		require.NoError(t, get(client, context.Background(), fmt.Sprintf("api.busy-%d.com", i)))
+	}
+	assert.Equal(t, 64, limits.Len(), "buckets that filled up again must be dropped")
+}
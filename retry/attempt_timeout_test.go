@@ -0,0 +1,61 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_retry_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/retry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPerAttemptTimeoutRetriesHungAttempt(t *testing.T) {
+	transport := &hedgingTransport{delays: []time.Duration{time.Second, time.Millisecond}, codes: []int{200}}
+	client := httpwares.TripperwareChain{
+		http_retry.Tripperware(
+			http_retry.WithMax(3),
+			http_retry.WithBackoff(http_retry.BackoffLinear(0)),
+			http_retry.WithPerAttemptTimeout(50*time.Millisecond),
+		),
+	}.WrapClient(&http.Client{Transport: transport})
+	req, _ := http.NewRequest("GET", "http://something.local/someurl", strings.NewReader("body"))
+	startTime := time.Now()
+	resp, err := client.Do(req)
+	require.NoError(t, err, "call shouldn't fail")
+	_, err = ioutil.ReadAll(resp.Body)
+	require.NoError(t, err, "the body of the successful attempt must be readable")
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode, "the second attempt must succeed")
+	assert.True(t, time.Since(startTime) < 500*time.Millisecond, "the hung attempt must time out")
+	calls, _, cancelled := transport.stats()
+	assert.Equal(t, 2, calls, "the timed out attempt must be retried")
+	assert.Equal(t, 1, cancelled, "the hung attempt must be cancelled")
+}
+
+func TestPerAttemptTimeoutStopsAtParentDeadline(t *testing.T) {
+	transport := &hedgingTransport{delays: []time.Duration{time.Second}, codes: []int{200}}
+	client := httpwares.TripperwareChain{
+		http_retry.Tripperware(
+			http_retry.WithMax(10),
+			http_retry.WithBackoff(http_retry.BackoffLinear(0)),
+			http_retry.WithPerAttemptTimeout(50*time.Millisecond),
+		),
+	}.WrapClient(&http.Client{Transport: transport})
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequest("GET", "http://something.local/someurl", strings.NewReader("body"))
+	startTime := time.Now()
+	_, err := client.Do(req.WithContext(ctx))
+	require.Error(t, err, "all attempts must time out")
+	assert.True(t, time.Since(startTime) < 500*time.Millisecond, "the parent deadline must end the retries")
+	calls, _, _ := transport.stats()
+	assert.True(t, calls >= 2 && calls <= 3, "only the attempts that fit in the parent deadline must be made, got %d", calls)
+}
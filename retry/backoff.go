@@ -1,6 +1,10 @@
 package http_retry
 
-import "time"
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
 
 // BackoffLinear is very simple: it waits for a fixed period of time between calls.
 func BackoffLinear(waitBetween time.Duration) BackoffFunc {
@@ -8,3 +12,98 @@ func BackoffLinear(waitBetween time.Duration) BackoffFunc {
 		return waitBetween
 	}
 }
+
+// BackoffExponential waits for an exponentially growing period of time between calls, up to a maximum.
+//
+// The first retry waits for `scalar`, and every next one waits twice as long as the previous one, but never more than
+// `max`.
+func BackoffExponential(scalar time.Duration, max time.Duration) BackoffFunc {
+	return func(attempt uint) time.Duration {
+		return exponentBase2(scalar, max, attempt)
+	}
+}
+
+// BackoffFullJitter waits for a random period of time between zero and the `BackoffExponential` duration.
+//
+// This spreads retries of many clients evenly in time, see:
+// https://www.awsarchitectureblog.com/2015/03/backoff.html
+//
+// The `src` is the source of randomness, allowing for deterministic tests. If nil, a time-seeded source is used.
+func BackoffFullJitter(scalar time.Duration, max time.Duration, src rand.Source) BackoffFunc {
+	rnd := newLockedRand(src)
+	return func(attempt uint) time.Duration {
+		return rnd.Duration(0, exponentBase2(scalar, max, attempt))
+	}
+}
+
+// BackoffEqualJitter waits for half of the `BackoffExponential` duration, plus a random period up to the other half.
+//
+// This guarantees that retries are never sent right away, while still spreading them in time.
+//
+// The `src` is the source of randomness, allowing for deterministic tests. If nil, a time-seeded source is used.
+func BackoffEqualJitter(scalar time.Duration, max time.Duration, src rand.Source) BackoffFunc {
+	rnd := newLockedRand(src)
+	return func(attempt uint) time.Duration {
+		half := exponentBase2(scalar, max, attempt) / 2
+		return half + rnd.Duration(0, half)
+	}
+}
+
+// BackoffDecorrelatedJitter waits for a random period between `scalar` and three times the previous wait, up to a maximum.
+//
+// Since the `BackoffFunc` is stateless, the previous wait is re-drawn for each attempt. The returned durations follow
+// the same distribution as the decorrelated jitter described in:
+// https://www.awsarchitectureblog.com/2015/03/backoff.html
+//
+// The `src` is the source of randomness, allowing for deterministic tests. If nil, a time-seeded source is used.
+func BackoffDecorrelatedJitter(scalar time.Duration, max time.Duration, src rand.Source) BackoffFunc {
+	rnd := newLockedRand(src)
+	return func(attempt uint) time.Duration {
+		wait := scalar
+		for i := uint(0); i < attempt; i++ {
+			wait = rnd.Duration(scalar, 3*wait)
+			if wait > max {
+				wait = max
+			}
+		}
+		return wait
+	}
+}
+
+// exponentBase2 computes scalar * 2^(attempt-1), capped at max.
+func exponentBase2(scalar time.Duration, max time.Duration, attempt uint) time.Duration {
+	wait := scalar
+	for i := uint(1); i < attempt; i++ {
+		wait *= 2
+		if wait >= max || wait <= 0 { // wait <= 0 on overflow
+			return max
+		}
+	}
+	if wait > max {
+		return max
+	}
+	return wait
+}
+
+// lockedRand is a *rand.Rand that is safe for concurrent use by multiple requests.
+type lockedRand struct {
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+func newLockedRand(src rand.Source) *lockedRand {
+	if src == nil {
+		src = rand.NewSource(time.Now().UnixNano())
+	}
+	return &lockedRand{rnd: rand.New(src)}
+}
+
+// Duration returns a random duration in [min, max).
+func (l *lockedRand) Duration(min time.Duration, max time.Duration) time.Duration {
+	if max <= min {
+		return min
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return min + time.Duration(l.rnd.Int63n(int64(max-min)))
+}
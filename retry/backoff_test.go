@@ -0,0 +1,73 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_retry_test
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-httpwares/retry"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoffExponential(t *testing.T) {
+	backoff := http_retry.BackoffExponential(10*time.Millisecond, 100*time.Millisecond)
+	for attempt, expected := range []time.Duration{
+		1: 10 * time.Millisecond,
+		2: 20 * time.Millisecond,
+		3: 40 * time.Millisecond,
+		4: 80 * time.Millisecond,
+		5: 100 * time.Millisecond,
+		6: 100 * time.Millisecond,
+	} {
+		if attempt == 0 {
+			continue
+		}
+		assert.Equal(t, expected, backoff(uint(attempt)), "wrong backoff for attempt %d", attempt)
+	}
+	assert.Equal(t, 100*time.Millisecond, backoff(1000), "large attempts must not overflow")
+}
+
+func TestBackoffJitters(t *testing.T) {
+	scalar, max := 10*time.Millisecond, 200*time.Millisecond
+	for _, tcase := range []struct {
+		name   string
+		newFn  func(src rand.Source) http_retry.BackoffFunc
+		bounds func(attempt uint) (time.Duration, time.Duration)
+	}{
+		{
+			name:  "full",
+			newFn: func(src rand.Source) http_retry.BackoffFunc { return http_retry.BackoffFullJitter(scalar, max, src) },
+			bounds: func(attempt uint) (time.Duration, time.Duration) {
+				return 0, http_retry.BackoffExponential(scalar, max)(attempt)
+			},
+		},
+		{
+			name:  "equal",
+			newFn: func(src rand.Source) http_retry.BackoffFunc { return http_retry.BackoffEqualJitter(scalar, max, src) },
+			bounds: func(attempt uint) (time.Duration, time.Duration) {
+				exp := http_retry.BackoffExponential(scalar, max)(attempt)
+				return exp / 2, exp
+			},
+		},
+		{
+			name:  "decorrelated",
+			newFn: func(src rand.Source) http_retry.BackoffFunc { return http_retry.BackoffDecorrelatedJitter(scalar, max, src) },
+			bounds: func(attempt uint) (time.Duration, time.Duration) {
+				return scalar, max
+			},
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			first, second := tcase.newFn(rand.NewSource(1337)), tcase.newFn(rand.NewSource(1337))
+			for attempt := uint(1); attempt < 10; attempt++ {
+				wait := first(attempt)
+				assert.Equal(t, wait, second(attempt), "same seed must yield the same backoff")
+				min, max := tcase.bounds(attempt)
+				assert.True(t, wait >= min && wait <= max, "backoff %v for attempt %d must be in [%v, %v]", wait, attempt, min, max)
+			}
+		})
+	}
+}
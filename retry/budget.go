@@ -0,0 +1,121 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_retry
+
+import (
+	"sync"
+	"time"
+)
+
+// Budget limits the number of retries made to a service, to prevent retry storms during outages.
+//
+// It is a token bucket kept separately for each service (the `http.call.service` tag set by `http_ctxtags.Tripperware`,
+// or the host of the request if it is not set). Each request adds `retryRatio` tokens to the bucket, and additional
+// `minRetriesPerSecond` tokens are added every second. Each retry takes one token, and if there are none left the retry
+// is skipped and the last response or error is returned.
+//
+// For example a budget of `NewBudget(0.1, 5, 50)` allows retries of at most 10% of requests plus 5 retries a second,
+// with at most 50 retries accumulated while there was no need for them.
+//
+// A single Budget is meant to be shared between Tripperwares, and is safe for concurrent use.
+type Budget struct {
+	retryRatio          float64
+	minRetriesPerSecond float64
+	maxBalance          float64
+
+	mu       sync.Mutex
+	services map[string]*serviceBudget
+}
+
+// BudgetStats is a snapshot of the state of the Budget for a single service, meant for metrics.
+type BudgetStats struct {
+	// Balance is the number of retries that can be made right now.
+	Balance float64
+	// Requests is the total number of requests that were made.
+	Requests uint64
+	// Retries is the total number of retries that were allowed.
+	Retries uint64
+	// RetriesSkipped is the total number of retries that were not made because the budget ran out.
+	RetriesSkipped uint64
+}
+
+type serviceBudget struct {
+	stats      BudgetStats
+	lastRefill time.Time
+}
+
+// NewBudget creates a new retry budget.
+//
+// The `retryRatio` is the fraction of requests that may be retried, `minRetriesPerSecond` the number of retries
+// allowed regardless of the number of requests and `maxBalance` caps the number of retries that can be accumulated.
+func NewBudget(retryRatio float64, minRetriesPerSecond float64, maxBalance float64) *Budget {
+	return &Budget{
+		retryRatio:          retryRatio,
+		minRetriesPerSecond: minRetriesPerSecond,
+		maxBalance:          maxBalance,
+		services:            make(map[string]*serviceBudget),
+	}
+}
+
+// Stats returns a snapshot of the budget state for each of the services seen so far.
+func (b *Budget) Stats() map[string]BudgetStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	ret := make(map[string]BudgetStats, len(b.services))
+	for service, s := range b.services {
+		b.refill(s, now)
+		ret[service] = s.stats
+	}
+	return ret
+}
+
+// deposit records a new request to the service, adding to the retry budget.
+func (b *Budget) deposit(service string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.service(service)
+	s.stats.Requests++
+	s.stats.Balance += b.retryRatio
+	if s.stats.Balance > b.maxBalance {
+		s.stats.Balance = b.maxBalance
+	}
+}
+
+// withdraw checks whether a retry of a request to the service is allowed, and if so takes it out of the budget.
+func (b *Budget) withdraw(service string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.service(service)
+	b.refill(s, time.Now())
+	if s.stats.Balance < 1.0 {
+		s.stats.RetriesSkipped++
+		return false
+	}
+	s.stats.Balance -= 1.0
+	s.stats.Retries++
+	return true
+}
+
+func (b *Budget) service(service string) *serviceBudget {
+	s, ok := b.services[service]
+	if !ok {
+		s = &serviceBudget{lastRefill: time.Now()}
+		s.stats.Balance = b.maxBalance
+		b.services[service] = s
+	}
+	return s
+}
+
+func (b *Budget) refill(s *serviceBudget, now time.Time) {
+	elapsed := now.Sub(s.lastRefill)
+	if elapsed <= 0 {
+		return
+	}
+	s.lastRefill = now
+	s.stats.Balance += elapsed.Seconds() * b.minRetriesPerSecond
+	if s.stats.Balance > b.maxBalance {
+		s.stats.Balance = b.maxBalance
+	}
+}
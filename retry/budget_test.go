@@ -0,0 +1,75 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_retry_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/retry"
+	"github.com/mwitkow/go-httpwares/tags"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBudgetSkipsRetriesWhenExhausted(t *testing.T) {
+	transport := &hedgingTransport{delays: []time.Duration{0}, codes: []int{503}}
+	budget := http_retry.NewBudget(0.5, 0, 1)
+	client := httpwares.TripperwareChain{
+		http_ctxtags.Tripperware(http_ctxtags.WithServiceName("flaky")),
+		http_retry.Tripperware(
+			http_retry.WithMax(3),
+			http_retry.WithBackoff(http_retry.BackoffLinear(0)),
+			http_retry.WithBudget(budget),
+		),
+	}.WrapClient(&http.Client{Transport: transport})
+
+	expectedCalls := []int{2, 1, 2}
+	for i, expected := range expectedCalls {
+		transport.mu.Lock()
+		transport.calls = 0
+		transport.mu.Unlock()
+		req, _ := http.NewRequest("GET", "http://something.local/someurl", strings.NewReader("body"))
+		resp, err := client.Do(req)
+		require.NoError(t, err, "call shouldn't fail")
+		resp.Body.Close()
+		assert.Equal(t, 503, resp.StatusCode, "the last response must be returned")
+		calls, _, _ := transport.stats()
+		assert.Equal(t, expected, calls, "request %d made a wrong number of attempts", i)
+	}
+
+	stats, ok := budget.Stats()["flaky"]
+	require.True(t, ok, "the budget must be kept by service name")
+	assert.EqualValues(t, 3, stats.Requests, "all requests must be counted")
+	assert.EqualValues(t, 2, stats.Retries, "only retries within budget must be made")
+	assert.EqualValues(t, 3, stats.RetriesSkipped, "retries over the budget must be counted")
+}
+
+func TestBudgetRefillsOverTime(t *testing.T) {
+	transport := &hedgingTransport{delays: []time.Duration{0}, codes: []int{503, 200}}
+	budget := http_retry.NewBudget(0, 100, 1)
+	client := httpwares.TripperwareChain{
+		http_retry.Tripperware(
+			http_retry.WithMax(2),
+			http_retry.WithBackoff(http_retry.BackoffLinear(0)),
+			http_retry.WithBudget(budget),
+		),
+	}.WrapClient(&http.Client{Transport: transport})
+
+	for i := 0; i < 2; i++ {
+		transport.mu.Lock()
+		transport.calls = 0
+		transport.mu.Unlock()
+		time.Sleep(20 * time.Millisecond) // enough for a 100 per second refill.
+		req, _ := http.NewRequest("GET", "http://something.local/someurl", strings.NewReader("body"))
+		resp, err := client.Do(req)
+		require.NoError(t, err, "call shouldn't fail")
+		resp.Body.Close()
+		assert.Equal(t, 200, resp.StatusCode, "request %d must be retried with a refilled budget", i)
+	}
+	assert.EqualValues(t, 2, budget.Stats()["something.local"].Retries, "the host is used when there's no service name")
+}
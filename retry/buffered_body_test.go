@@ -0,0 +1,100 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_retry_test
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/retry"
+	"github.com/mwitkow/go-httpwares/tags"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bodyRecordingTransport is a fake RoundTripper that records the bodies and outbound tags of requests it gets.
+type bodyRecordingTransport struct {
+	mu     sync.Mutex
+	codes  []int
+	bodies []string
+	tags   map[string]interface{}
+}
+
+func (b *bodyRecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	body := ""
+	if req.Body != nil {
+		data, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		body = string(data)
+	}
+	b.tags = http_ctxtags.ExtractOutbound(req).Values()
+	code := b.codes[len(b.codes)-1]
+	if len(b.bodies) < len(b.codes) {
+		code = b.codes[len(b.bodies)]
+	}
+	b.bodies = append(b.bodies, body)
+	return &http.Response{StatusCode: code, Body: ioutil.NopCloser(strings.NewReader("")), Request: req}, nil
+}
+
+// opaqueReader hides the type of the reader, so that `http.NewRequest` can't implement `GetBody` for it.
+type opaqueReader struct {
+	io.Reader
+}
+
+func bufferingClient(transport http.RoundTripper, opts ...http_retry.Option) *http.Client {
+	opts = append([]http_retry.Option{http_retry.WithMax(3), http_retry.WithBackoff(http_retry.BackoffLinear(0))}, opts...)
+	return httpwares.TripperwareChain{
+		http_ctxtags.Tripperware(),
+		http_retry.Tripperware(opts...),
+	}.WrapClient(&http.Client{Transport: transport})
+}
+
+func TestUnreplayableBodyIsNotRetriedByDefault(t *testing.T) {
+	transport := &bodyRecordingTransport{codes: []int{503, 200}}
+	req, _ := http.NewRequest("GET", "http://something.local/someurl", &opaqueReader{strings.NewReader("body")})
+	resp, err := bufferingClient(transport).Do(req)
+	require.NoError(t, err, "call shouldn't fail")
+	assert.Equal(t, 503, resp.StatusCode, "the request must not be retried")
+	assert.Equal(t, []string{"body"}, transport.bodies, "the body must be sent once")
+	assert.Equal(t, http_retry.SkippedBodyNotReplayable, transport.tags[http_retry.TagForRetrySkipped], "the skip must be tagged")
+}
+
+func TestBufferedBodyIsReplayed(t *testing.T) {
+	transport := &bodyRecordingTransport{codes: []int{503, 200}}
+	req, _ := http.NewRequest("GET", "http://something.local/someurl", &opaqueReader{strings.NewReader("body")})
+	resp, err := bufferingClient(transport, http_retry.WithBufferedBody(1024)).Do(req)
+	require.NoError(t, err, "call shouldn't fail")
+	assert.Equal(t, 200, resp.StatusCode, "the request must be retried")
+	assert.Equal(t, []string{"body", "body"}, transport.bodies, "the whole body must be sent on every attempt")
+	assert.NotContains(t, transport.tags, http_retry.TagForRetrySkipped, "retries must not be marked as skipped")
+}
+
+func TestBufferedBodyOverLimitStreamsWithoutRetries(t *testing.T) {
+	transport := &bodyRecordingTransport{codes: []int{503, 200}}
+	req, _ := http.NewRequest("GET", "http://something.local/someurl", &opaqueReader{strings.NewReader("a larger body")})
+	resp, err := bufferingClient(transport, http_retry.WithBufferedBody(4)).Do(req)
+	require.NoError(t, err, "call shouldn't fail")
+	assert.Equal(t, 503, resp.StatusCode, "the request must not be retried")
+	assert.Equal(t, []string{"a larger body"}, transport.bodies, "the whole body must be streamed through")
+	assert.Equal(t, http_retry.SkippedBodyTooLarge, transport.tags[http_retry.TagForRetrySkipped], "the skip must be tagged")
+}
+
+func TestRequestWithoutBodyIsRetried(t *testing.T) {
+	transport := &bodyRecordingTransport{codes: []int{503, 200}}
+	req, _ := http.NewRequest("GET", "http://something.local/someurl", nil)
+	resp, err := bufferingClient(transport).Do(req)
+	require.NoError(t, err, "call shouldn't fail")
+	assert.Equal(t, 200, resp.StatusCode, "requests without a body must be retried")
+	assert.Len(t, transport.bodies, 2, "the request must be sent twice")
+}
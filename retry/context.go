@@ -9,10 +9,15 @@ import (
 	"golang.org/x/net/context"
 )
 
-type ctxMarker struct{}
+// ctxMarker is named, as pointers to distinct zero-sized values are not guaranteed to be different.
+type ctxMarker struct {
+	name string
+}
 
 var (
-	ctxEnableRetry = &ctxMarker{}
+	ctxEnableRetry  = &ctxMarker{"enable"}
+	ctxDisableRetry = &ctxMarker{"disable"}
+	ctxOverrides    = &ctxMarker{"overrides"}
 )
 
 // Enable turns on the retry logic for a given request, regardless of what the retry decider says.
@@ -35,7 +40,60 @@ func EnableContext(ctx context.Context) context.Context {
 	return context.WithValue(ctx, ctxEnableRetry, true)
 }
 
+// Disable turns off the retry logic for a given request, regardless of what the retry decider or `Enable` say.
+//
+// Please make sure you do not pass around this request's context.
+func Disable(req *http.Request) *http.Request {
+	if isDisabled(req.Context()) {
+		return req
+	}
+	return req.WithContext(DisableContext(req.Context()))
+}
+
+// DisableContext turns off the retry logic for a given request's context, regardless of what the retry decider or
+// `Enable` say.
+//
+// Please make sure you do not pass around this request's context.
+func DisableContext(ctx context.Context) context.Context {
+	if isDisabled(ctx) {
+		return ctx
+	}
+	return context.WithValue(ctx, ctxDisableRetry, true)
+}
+
+// Override changes the retry options for a given request, e.g. `WithMax`, `WithBackoff`, `WithResponseDiscarder` or
+// `WithPerAttemptTimeout`.
+//
+// The options are applied on top of the ones the Tripperware was created with, and subsequent calls compose. This
+// allows a single client to serve both latency-critical and batch callers.
+//
+// Please make sure you do not pass around this request's context.
+func Override(req *http.Request, opts ...Option) *http.Request {
+	return req.WithContext(OverrideContext(req.Context(), opts...))
+}
+
+// OverrideContext changes the retry options for a given request's context, see `Override`.
+//
+// Please make sure you do not pass around this request's context.
+func OverrideContext(ctx context.Context, opts ...Option) context.Context {
+	existing := overridesFromContext(ctx)
+	combined := make([]Option, 0, len(existing)+len(opts))
+	combined = append(combined, existing...)
+	combined = append(combined, opts...)
+	return context.WithValue(ctx, ctxOverrides, combined)
+}
+
 func isEnabled(ctx context.Context) bool {
 	_, ok := ctx.Value(ctxEnableRetry).(bool)
 	return ok
 }
+
+func isDisabled(ctx context.Context) bool {
+	_, ok := ctx.Value(ctxDisableRetry).(bool)
+	return ok
+}
+
+func overridesFromContext(ctx context.Context) []Option {
+	opts, _ := ctx.Value(ctxOverrides).([]Option)
+	return opts
+}
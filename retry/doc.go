@@ -4,8 +4,34 @@
 /*
 `http_retry` is a HTTP client-side Tripperware that allows you to retry requests that are marked as idempotent and safe.
 
-This logic works for requests considered safe and idempotent (configurable) and ones that have no body, or have `Request.GetBody` either automatically implemented (`byte.Buffer`, `string.Buffer`) or specified manually. By default all GET, HEAD and OPTIONS requests are considered idempotent and safe.
+This logic works for requests considered safe and idempotent (configurable) and ones that have no body, or have `Request.GetBody` either automatically implemented (`byte.Buffer`, `string.Buffer`) or specified manually. By default all GET, HEAD and OPTIONS requests are considered idempotent and safe. Other bodies can be buffered in memory for retries with `WithBufferedBody`.
 
-The implementation allow retries after client-side errors or returned error codes (by default 5**) according to configurable backoff policies (linear backoff by default). Additionally, requests can be hedged. Hedging works by sending additional requests without waiting for a previous one to return.
+The implementation allow retries after client-side errors or returned error codes (by default 429 and 5**) according to configurable backoff policies (linear backoff by default). A `Retry-After` header sent by the server takes precedence over the backoff policy. Additionally, requests can be hedged. Hedging works by sending additional requests without waiting for a previous one to return.
+
+Hedging
+
+Hedging is turned on with `WithHedgingDelay` or `WithHedgingPercentile`. Another attempt is sent if the previous one
+didn't return within a fixed delay, or within a percentile of the latencies observed recently. The first response that
+is not discarded wins, and all other attempts are cancelled and have their bodies drained. The number of attempts in
+flight at once is capped by `WithHedgingMaxParallel`. Discarded attempts are retried without waiting for the delay, but a
+`Retry-After` header holds off both the retries and the hedged attempts.
+
+Resumable Downloads
+
+Retries only cover failures before the response is returned. With `WithResumableBody`, a read of a large response body
+that fails midway, e.g. due to a connection reset, is transparently continued with a `Range` request, as long as the
+server supports byte ranges and the resource has a strong `ETag`.
+
+Per-request Overrides
+
+The options of the Tripperware can be changed for a single request by passing `http_retry.Override` the same `With*`
+options, e.g. to give a latency-critical call fewer attempts than a batch job sharing the same client.
+`http_retry.Disable` turns retries off for a request entirely.
+
+Retry Budgets
+
+Retrying every failed request multiplies the load on a struggling backend. A `Budget` shared between Tripperwares
+limits the retries made to each service (`http.call.service` tag) to a fraction of requests plus a fixed rate, skipping
+retries once it runs out. Its state can be read with `Budget.Stats` for metrics.
 */
 package http_retry
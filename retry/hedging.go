@@ -0,0 +1,286 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_retry
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mwitkow/go-httpwares/internal"
+	"github.com/mwitkow/go-httpwares/tags"
+)
+
+const (
+	// hedgingWindowSize is the number of most recent attempt latencies used for computing the hedging percentile.
+	hedgingWindowSize = 100
+	// hedgingMinSamples is the number of latencies needed before the percentile is trusted.
+	hedgingMinSamples = 10
+)
+
+// hedger sends additional attempts of a request without waiting for the previous ones to return.
+//
+// It keeps a window of recent latencies of this Tripperware, used for the percentile-based hedging delay.
+type hedger struct {
+	latencies *latencyWindow
+}
+
+type hedgedAttempt struct {
+	startTime time.Time
+	cancel    context.CancelFunc
+	returned  bool
+	resp      *http.Response
+	err       error
+}
+
+func newHedger() *hedger {
+	return &hedger{latencies: newLatencyWindow(hedgingWindowSize)}
+}
+
+// RoundTrip sends the hedged attempts of the request, using the options in effect for this request.
+func (h *hedger) RoundTrip(next http.RoundTripper, req *http.Request, o *options) (*http.Response, error) {
+	parentCtx := req.Context()
+	// Buffered for all attempts, so that goroutines of abandoned attempts never block.
+	results := make(chan *hedgedAttempt, o.maxRetry)
+	var attempts []*hedgedAttempt
+	inFlight := uint(0)
+	tags := http_ctxtags.ExtractOutbound(req)
+	defer func() {
+		tags.Set(TagForRetryAttempts, len(attempts))
+	}()
+	launch := func(reason string) error {
+		var ctx context.Context
+		var cancel context.CancelFunc
+		if o.perAttemptTimeout > 0 {
+			ctx, cancel = context.WithTimeout(parentCtx, o.perAttemptTimeout)
+		} else {
+			ctx, cancel = context.WithCancel(parentCtx)
+		}
+		attemptReq, err := newAttemptRequest(req, withAttemptTags(ctx, tags, uint(len(attempts)), reason))
+		if err != nil {
+			cancel()
+			return err
+		}
+		attempt := &hedgedAttempt{startTime: time.Now(), cancel: cancel}
+		attempts = append(attempts, attempt)
+		inFlight++
+		go func() {
+			attempt.resp, attempt.err = next.RoundTrip(attemptReq)
+			results <- attempt
+		}()
+		return nil
+	}
+	// stopped is set once no more attempts are to be sent, e.g. when the retry budget is exhausted.
+	stopped := false
+	canLaunch := func() bool {
+		return !stopped && uint(len(attempts)) < o.maxRetry && inFlight < o.hedgingMaxParallel
+	}
+	retryAllowed := func() bool {
+		if o.budget == nil || o.budget.withdraw(http_ctxtags.ServiceName(req)) {
+			return true
+		}
+		stopped = true
+		return false
+	}
+	abandonAll := func(last *hedgedAttempt) {
+		for _, a := range attempts {
+			if !a.returned {
+				a.cancel() // the goroutine will still return the attempt on results.
+			}
+		}
+		drainAttempts(results, inFlight)
+		abandonAttempt(last)
+	}
+
+	if err := launch(""); err != nil {
+		return nil, err
+	}
+	var last *hedgedAttempt
+	// Failed attempts are retried without waiting for the hedging delay, but not before the server allows it with a
+	// `Retry-After` header.
+	retriesPending := 0
+	retryReasonPending := ""
+	var notBefore time.Time
+	// A single timer is reused for all hedging delays, it is stopped and drained before each reset.
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+	timerArmed := false
+	for {
+		if parentCtx.Err() != nil {
+			abandonAll(last)
+			return nil, parentCtx.Err()
+		}
+		if inFlight == 0 && (retriesPending == 0 || !canLaunch()) {
+			return finishAttempt(last)
+		}
+		if timerArmed && !timer.Stop() {
+			<-timer.C
+		}
+		timerArmed = false
+		var hedgeTimer <-chan time.Time
+		retrying := retriesPending > 0 && canLaunch()
+		if retrying {
+			timer.Reset(notBefore.Sub(time.Now()))
+			timerArmed = true
+			hedgeTimer = timer.C
+		} else if delay, ok := h.hedgingDelay(o); ok && canLaunch() {
+			wait := delay - time.Since(attempts[len(attempts)-1].startTime)
+			if untilAllowed := notBefore.Sub(time.Now()); untilAllowed > wait {
+				wait = untilAllowed
+			}
+			timer.Reset(wait)
+			timerArmed = true
+			hedgeTimer = timer.C
+		}
+		select {
+		case <-parentCtx.Done():
+			abandonAll(last)
+			return nil, parentCtx.Err()
+		case <-hedgeTimer:
+			timerArmed = false // the timer fired and got drained.
+			if !retryAllowed() {
+				continue // wait for the attempts in flight.
+			}
+			reason := RetryReasonHedge
+			if retrying {
+				reason = retryReasonPending
+				retriesPending--
+			}
+			if err := launch(reason); err != nil {
+				abandonAll(last)
+				return nil, err
+			}
+		case attempt := <-results:
+			inFlight--
+			attempt.returned = true
+			if attempt.err == nil {
+				h.latencies.Observe(time.Since(attempt.startTime))
+			}
+			if attempt.err == nil && !o.discarder(attempt.resp) {
+				abandonAll(last)
+				return finishAttempt(attempt)
+			}
+			abandonAttempt(last)
+			last = attempt
+			if isContextError(attempt.err) && parentCtx.Err() != nil {
+				continue // the parent context is done, handled above.
+			}
+			if waitTime, giveUp, ok := retryAfter(attempt.resp, parentCtx, o); giveUp {
+				stopped = true // the server asked us to wait past our deadline.
+			} else if ok {
+				notBefore = time.Now().Add(waitTime)
+			}
+			// An attempt failed, there's no point in waiting for the hedging delay.
+			retriesPending++
+			retryReasonPending = retryReason(attempt.err)
+		}
+	}
+}
+
+// hedgingDelay returns the time after the last attempt after which another one should be sent.
+func (h *hedger) hedgingDelay(o *options) (time.Duration, bool) {
+	if o.hedgingPercentile > 0 {
+		if delay, ok := h.latencies.Percentile(o.hedgingPercentile); ok {
+			return delay, true
+		}
+	}
+	if o.hedgingDelay > 0 {
+		return o.hedgingDelay, true
+	}
+	return 0, false
+}
+
+// finishAttempt returns the result of the attempt to the caller, tying the attempt's context to the response body.
+func finishAttempt(attempt *hedgedAttempt) (*http.Response, error) {
+	if attempt.resp == nil {
+		attempt.cancel()
+		return nil, attempt.err
+	}
+	attempt.resp.Body = &cancelOnCloseBody{ReadCloser: attempt.resp.Body, cancel: attempt.cancel}
+	return attempt.resp, attempt.err
+}
+
+// abandonAttempt cancels an attempt that has already returned and releases its connection.
+func abandonAttempt(attempt *hedgedAttempt) {
+	if attempt == nil {
+		return
+	}
+	http_internal.DrainAndClose(attempt.resp)
+	attempt.cancel()
+}
+
+// drainAttempts releases the responses of attempts still in flight in the background.
+func drainAttempts(results chan *hedgedAttempt, inFlight uint) {
+	if inFlight == 0 {
+		return
+	}
+	go func() {
+		for i := uint(0); i < inFlight; i++ {
+			abandonAttempt(<-results)
+		}
+	}()
+}
+
+// cancelOnCloseBody cancels the context of the request once the response body is closed.
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnCloseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// latencyWindow is a thread-safe ring buffer of recent latencies.
+type latencyWindow struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+	full    bool
+}
+
+func newLatencyWindow(size int) *latencyWindow {
+	return &latencyWindow{samples: make([]time.Duration, size)}
+}
+
+func (w *latencyWindow) Observe(d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % len(w.samples)
+	if w.next == 0 {
+		w.full = true
+	}
+}
+
+// Percentile returns the latency at the given percentile (0-100], if enough samples were observed.
+func (w *latencyWindow) Percentile(percentile float64) (time.Duration, bool) {
+	w.mu.Lock()
+	count := w.next
+	if w.full {
+		count = len(w.samples)
+	}
+	if count < hedgingMinSamples {
+		w.mu.Unlock()
+		return 0, false
+	}
+	sorted := make([]time.Duration, count)
+	copy(sorted, w.samples[:count])
+	w.mu.Unlock()
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	idx := int(math.Ceil(float64(count)*percentile/100.0)) - 1
+	if idx < 0 {
+		idx = 0
+	} else if idx >= count {
+		idx = count - 1
+	}
+	return sorted[idx], true
+}
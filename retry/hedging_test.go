@@ -0,0 +1,212 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_retry_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/retry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockUntilCancelled is the delay of attempts that never return a response, until they are cancelled.
+const blockUntilCancelled = time.Duration(-1)
+
+// hedgingTransport is a fake RoundTripper that returns responses after delays given per attempt.
+type hedgingTransport struct {
+	mu          sync.Mutex
+	delays      []time.Duration
+	codes       []int
+	calls       int
+	inFlight    int
+	maxInFlight int
+	cancelled   int
+	// header is set on all the responses.
+	header http.Header
+	// cancels receives a value for every cancelled attempt, if set.
+	cancels chan struct{}
+}
+
+func (h *hedgingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	h.mu.Lock()
+	attempt := h.calls
+	h.calls++
+	h.inFlight++
+	if h.inFlight > h.maxInFlight {
+		h.maxInFlight = h.inFlight
+	}
+	delay, code := h.delays[len(h.delays)-1], h.codes[len(h.codes)-1]
+	if attempt < len(h.delays) {
+		delay = h.delays[attempt]
+	}
+	if attempt < len(h.codes) {
+		code = h.codes[attempt]
+	}
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		h.inFlight--
+		h.mu.Unlock()
+	}()
+	var responded <-chan time.Time
+	if delay != blockUntilCancelled {
+		responded = time.After(delay)
+	}
+	select {
+	case <-req.Context().Done():
+		h.mu.Lock()
+		h.cancelled++
+		h.mu.Unlock()
+		if h.cancels != nil {
+			h.cancels <- struct{}{}
+		}
+		return nil, req.Context().Err()
+	case <-responded:
+	}
+	return &http.Response{
+		StatusCode: code,
+		Header:     h.header,
+		Body:       ioutil.NopCloser(strings.NewReader(req.Header.Get("attempt-marker"))),
+		Request:    req,
+	}, nil
+}
+
+// waitForCancelled waits until the given number of attempts got cancelled.
+func (h *hedgingTransport) waitForCancelled(t *testing.T, count int) {
+	for i := 0; i < count; i++ {
+		select {
+		case <-h.cancels:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("the attempt must be cancelled")
+		}
+	}
+}
+
+func (h *hedgingTransport) stats() (calls int, maxInFlight int, cancelled int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.calls, h.maxInFlight, h.cancelled
+}
+
+func TestHedgingReturnsFastestAttemptAndCancelsOthers(t *testing.T) {
+	transport := &hedgingTransport{delays: []time.Duration{blockUntilCancelled, 0}, codes: []int{200}, cancels: make(chan struct{}, 3)}
+	client := httpwares.TripperwareChain{
+		http_retry.Tripperware(http_retry.WithMax(3), http_retry.WithHedgingDelay(20*time.Millisecond)),
+	}.WrapClient(&http.Client{Transport: transport})
+	req, _ := http.NewRequest("GET", "http://something.local/someurl", strings.NewReader("body"))
+	resp, err := client.Do(req)
+	require.NoError(t, err, "the hedged attempt should return, as the first one never does")
+	resp.Body.Close()
+	transport.waitForCancelled(t, 1) // cancellation happens in the background
+	calls, _, cancelled := transport.stats()
+	assert.Equal(t, 2, calls, "only one hedged attempt should be sent")
+	assert.Equal(t, 1, cancelled, "the slow attempt must be cancelled")
+}
+
+func TestHedgingSendsNextAttemptOnDiscardedResponse(t *testing.T) {
+	transport := &hedgingTransport{delays: []time.Duration{0}, codes: []int{503, 503, 200}}
+	client := httpwares.TripperwareChain{
+		http_retry.Tripperware(http_retry.WithMax(5), http_retry.WithHedgingDelay(time.Hour)),
+	}.WrapClient(&http.Client{Transport: transport})
+	req, _ := http.NewRequest("GET", "http://something.local/someurl", strings.NewReader("body"))
+	startTime := time.Now()
+	resp, err := client.Do(req)
+	require.NoError(t, err, "call shouldn't fail")
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode, "the first good response should be returned")
+	assert.True(t, time.Since(startTime) < time.Minute, "failed attempts should not wait for the hedging delay")
+	calls, _, _ := transport.stats()
+	assert.Equal(t, 3, calls, "attempts should stop after a good response")
+}
+
+func TestHedgingWaitsForRetryAfter(t *testing.T) {
+	transport := &hedgingTransport{delays: []time.Duration{0}, codes: []int{503, 200}, header: http.Header{"Retry-After": []string{"1"}}}
+	client := httpwares.TripperwareChain{
+		http_retry.Tripperware(
+			http_retry.WithMax(5),
+			http_retry.WithHedgingDelay(time.Hour),
+			http_retry.WithMaxRetryAfter(50*time.Millisecond),
+		),
+	}.WrapClient(&http.Client{Transport: transport})
+	req, _ := http.NewRequest("GET", "http://something.local/someurl", strings.NewReader("body"))
+	startTime := time.Now()
+	resp, err := client.Do(req)
+	require.NoError(t, err, "call shouldn't fail")
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode, "the response after waiting should be returned")
+	assert.True(t, time.Since(startTime) >= 50*time.Millisecond, "the next attempt must wait for the Retry-After")
+	calls, _, _ := transport.stats()
+	assert.Equal(t, 2, calls)
+}
+
+func TestHedgingRespectsMaxParallel(t *testing.T) {
+	transport := &hedgingTransport{delays: []time.Duration{50 * time.Millisecond}, codes: []int{503}}
+	client := httpwares.TripperwareChain{
+		http_retry.Tripperware(
+			http_retry.WithMax(6),
+			http_retry.WithHedgingDelay(time.Millisecond),
+			http_retry.WithHedgingMaxParallel(2),
+		),
+	}.WrapClient(&http.Client{Transport: transport})
+	req, _ := http.NewRequest("GET", "http://something.local/someurl", strings.NewReader("body"))
+	resp, err := client.Do(req)
+	require.NoError(t, err, "call shouldn't fail")
+	resp.Body.Close()
+	assert.Equal(t, 503, resp.StatusCode, "the last discarded response should be returned")
+	calls, maxInFlight, _ := transport.stats()
+	assert.Equal(t, 6, calls, "all attempts should be used")
+	assert.Equal(t, 2, maxInFlight, "no more than the max parallel attempts should be in flight")
+}
+
+func TestHedgingRespectsDecider(t *testing.T) {
+	transport := &hedgingTransport{delays: []time.Duration{50 * time.Millisecond}, codes: []int{200}}
+	client := httpwares.TripperwareChain{
+		http_retry.Tripperware(http_retry.WithMax(3), http_retry.WithHedgingDelay(time.Millisecond)),
+	}.WrapClient(&http.Client{Transport: transport})
+	req, _ := http.NewRequest("POST", "http://something.local/someurl", strings.NewReader("body"))
+	resp, err := client.Do(req)
+	require.NoError(t, err, "call shouldn't fail")
+	resp.Body.Close()
+	calls, _, _ := transport.stats()
+	assert.Equal(t, 1, calls, "POST requests must not be hedged by default")
+}
+
+func TestHedgingPercentileUsesObservedLatencies(t *testing.T) {
+	// The first requests are slow, so that the percentile latency is far above the latency of the fast ones.
+	delays := []time.Duration{}
+	for i := 0; i < 10; i++ {
+		delays = append(delays, 100*time.Millisecond)
+	}
+	transport := &hedgingTransport{delays: append(delays, 0), codes: []int{200}, cancels: make(chan struct{}, 1)}
+	client := httpwares.TripperwareChain{
+		http_retry.Tripperware(http_retry.WithMax(2), http_retry.WithHedgingPercentile(90)),
+	}.WrapClient(&http.Client{Transport: transport})
+	for i := 0; i < 20; i++ {
+		req, _ := http.NewRequest("GET", "http://something.local/someurl", strings.NewReader("body"))
+		resp, err := client.Do(req)
+		require.NoError(t, err, "call shouldn't fail")
+		resp.Body.Close()
+	}
+	calls, _, _ := transport.stats()
+	require.Equal(t, 20, calls, "fast requests should not be hedged")
+
+	transport.mu.Lock()
+	transport.delays = []time.Duration{blockUntilCancelled, 0}
+	transport.calls = 0
+	transport.mu.Unlock()
+	req, _ := http.NewRequest("GET", "http://something.local/someurl", strings.NewReader("body"))
+	resp, err := client.Do(req)
+	require.NoError(t, err, "the slow request should be hedged after the percentile latency")
+	resp.Body.Close()
+	transport.waitForCancelled(t, 1)
+	calls, _, _ = transport.stats()
+	assert.Equal(t, 2, calls, "the slow request should be hedged once")
+}
@@ -14,6 +14,10 @@ var (
 		discarder:   DefaultResponseDiscarder,
 		maxRetry:    3,
 		backoffFunc: BackoffLinear(100 * time.Millisecond),
+
+		maxRetryAfter: 30 * time.Second,
+
+		hedgingMaxParallel: 2,
 	}
 )
 
@@ -22,6 +26,20 @@ type options struct {
 	discarder   ResponseDiscarderFunc
 	maxRetry    uint
 	backoffFunc BackoffFunc
+
+	maxRetryAfter     time.Duration
+	budget            *Budget
+	perAttemptTimeout time.Duration
+	bufferedBodyMax   int64
+	maxResumes        uint
+
+	hedgingDelay       time.Duration
+	hedgingPercentile  float64
+	hedgingMaxParallel uint
+}
+
+func (o *options) hedgingEnabled() bool {
+	return o.hedgingDelay > 0 || o.hedgingPercentile > 0
 }
 
 func evaluateOptions(opts []Option) *options {
@@ -33,6 +51,19 @@ func evaluateOptions(opts []Option) *options {
 	return optCopy
 }
 
+// withOverrides returns the options with the overrides applied, leaving the original options intact.
+func (o *options) withOverrides(overrides []Option) *options {
+	if len(overrides) == 0 {
+		return o
+	}
+	optCopy := &options{}
+	*optCopy = *o
+	for _, override := range overrides {
+		override(optCopy)
+	}
+	return optCopy
+}
+
 type Option func(*options)
 
 // RequestRetryDeciderFunc decides whether the given function is idempotent and safe or to retry.
@@ -57,12 +88,102 @@ func WithMax(maxRetries uint) Option {
 }
 
 // WithBackoff sets the `BackoffFunc `used to control time between retries.
+//
+// Apart from the default `BackoffLinear`, this package provides `BackoffExponential`, and the jittered
+// `BackoffFullJitter`, `BackoffEqualJitter` and `BackoffDecorrelatedJitter` that prevent clients from retrying in lockstep.
 func WithBackoff(bf BackoffFunc) Option {
 	return func(o *options) {
 		o.backoffFunc = bf
 	}
 }
 
+// WithMaxRetryAfter sets the maximum time to wait when the server asks for it with a `Retry-After` header.
+//
+// Both the delta-seconds and HTTP-date forms of the header are supported. The wait time takes precedence over the
+// `BackoffFunc`, but is capped at the given maximum. If waiting would exceed the deadline of the request's context, no
+// more retries are made and the last response is returned. By default the maximum is 30 seconds, setting it to 0
+// ignores the `Retry-After` headers.
+func WithMaxRetryAfter(maxWait time.Duration) Option {
+	return func(o *options) {
+		o.maxRetryAfter = maxWait
+	}
+}
+
+// WithPerAttemptTimeout limits the time of every single attempt, including reading of the response body.
+//
+// Each attempt gets its own context derived from the request's one. An attempt that times out is retried like any other
+// failed attempt, while the deadline of the request's context still ends all retries. By default there is no limit,
+// and a single hung attempt can use up the whole deadline of the request.
+func WithPerAttemptTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.perAttemptTimeout = timeout
+	}
+}
+
+// WithBufferedBody makes requests without `Request.GetBody` retriable, by buffering their body in memory.
+//
+// Requests built from a custom `io.Reader` have no `GetBody` function and by default are not retried at all. With this
+// option up to maxBytes of their body is read into memory and replayed for retries. Bodies larger than that are streamed
+// through without retries. Either way, skipped retries are recorded in the `http.retry.skipped` outbound ctxtag.
+func WithBufferedBody(maxBytes int64) Option {
+	return func(o *options) {
+		o.bufferedBodyMax = maxBytes
+	}
+}
+
+// WithResumableBody makes reads of response bodies that fail midway resume where they stopped, up to maxResumes times.
+//
+// This applies to GET requests for resources that the server advertised with `Accept-Ranges: bytes` and a strong
+// `ETag`. A failed read is resumed with a `Range` request with `If-Range` set to the ETag, and continues transparently
+// if the server responds with the rest of the same resource. By default reads of response bodies are not resumed.
+func WithResumableBody(maxResumes uint) Option {
+	return func(o *options) {
+		o.maxResumes = maxResumes
+	}
+}
+
+// WithBudget sets a retry budget that limits the number of retries made to each service.
+//
+// The same Budget can be shared between many Tripperwares, see `NewBudget` for details. Sequential retries, hedged
+// attempts and resumes of response bodies are all taken out of the budget.
+func WithBudget(b *Budget) Option {
+	return func(o *options) {
+		o.budget = b
+	}
+}
+
+// WithHedgingDelay turns on hedging of requests, sending another attempt if the previous one didn't return in time.
+//
+// Hedged attempts are sent without cancelling the ones that are in flight. The first response that is not discarded
+// (see `WithResponseDiscarder`) is returned, and all the other attempts are cancelled. Attempts that fail or return
+// a discarded response cause the next attempt to be sent immediately, without any backoff. The total number of attempts
+// is still limited by `WithMax`.
+func WithHedgingDelay(delay time.Duration) Option {
+	return func(o *options) {
+		o.hedgingDelay = delay
+	}
+}
+
+// WithHedgingPercentile turns on hedging of requests, with the delay based on the latency of previous attempts.
+//
+// Another attempt is sent if the previous one didn't return within the given percentile (e.g. 95.0) of latencies of
+// recent attempts made through this Tripperware. Until enough latencies are known, the `WithHedgingDelay` value is
+// used, or no hedging happens if it is not set.
+func WithHedgingPercentile(percentile float64) Option {
+	return func(o *options) {
+		o.hedgingPercentile = percentile
+	}
+}
+
+// WithHedgingMaxParallel sets the maximum number of attempts of a single request that can be in flight at once.
+//
+// By default, at most 2 attempts are in flight at the same time.
+func WithHedgingMaxParallel(maxParallel uint) Option {
+	return func(o *options) {
+		o.hedgingMaxParallel = maxParallel
+	}
+}
+
 // WithDecider is a function that allows users to customize the logic that decides whether a request is retriable.
 func WithDecider(f RequestRetryDeciderFunc) Option {
 	return func(o *options) {
@@ -71,9 +192,9 @@ func WithDecider(f RequestRetryDeciderFunc) Option {
 }
 
 // WithResponseDiscarder is a function that decides whether a given response should be discarded and another request attempted.
-func WithResponseDiscarder(f RequestRetryDeciderFunc) Option {
+func WithResponseDiscarder(f ResponseDiscarderFunc) Option {
 	return func(o *options) {
-		o.decider = f
+		o.discarder = f
 	}
 }
 
@@ -89,8 +210,8 @@ func DefaultRetriableDecider(req *http.Request) bool {
 
 // DefaultResponseDiscarder is the default implementation that discards responses in order to try again.
 //
-// It is fairly conservative and rejects (and thus retries) responses with 500, 503 and 504 status codes.
+// It is fairly conservative and rejects (and thus retries) responses with 429, 500, 503 and 504 status codes.
 // See https://en.wikipedia.org/wiki/List_of_HTTP_status_codes#5xx_Server_error
 func DefaultResponseDiscarder(resp *http.Response) bool {
-	return resp.StatusCode == 500 || resp.StatusCode == 503 || resp.StatusCode == 504
+	return resp.StatusCode == 429 || resp.StatusCode == 500 || resp.StatusCode == 503 || resp.StatusCode == 504
 }
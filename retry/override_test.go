@@ -0,0 +1,70 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_retry_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/retry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func overrideClient(transport http.RoundTripper) *http.Client {
+	return httpwares.TripperwareChain{
+		http_retry.Tripperware(http_retry.WithMax(5), http_retry.WithBackoff(http_retry.BackoffLinear(0))),
+	}.WrapClient(&http.Client{Transport: transport})
+}
+
+func TestOverrideChangesMaxForSingleRequest(t *testing.T) {
+	transport := &hedgingTransport{delays: []time.Duration{0}, codes: []int{503}}
+	client := overrideClient(transport)
+	req, _ := http.NewRequest("GET", "http://something.local/someurl", strings.NewReader("body"))
+	resp, err := client.Do(http_retry.Override(req, http_retry.WithMax(2)))
+	require.NoError(t, err, "call shouldn't fail")
+	resp.Body.Close()
+	calls, _, _ := transport.stats()
+	assert.Equal(t, 2, calls, "the overridden max must be used")
+
+	transport.mu.Lock()
+	transport.calls = 0
+	transport.mu.Unlock()
+	req, _ = http.NewRequest("GET", "http://something.local/someurl", strings.NewReader("body"))
+	resp, err = client.Do(req)
+	require.NoError(t, err, "call shouldn't fail")
+	resp.Body.Close()
+	calls, _, _ = transport.stats()
+	assert.Equal(t, 5, calls, "the override must not leak to other requests")
+}
+
+func TestOverridesCompose(t *testing.T) {
+	transport := &hedgingTransport{delays: []time.Duration{0}, codes: []int{404, 404, 200}}
+	client := overrideClient(transport)
+	req, _ := http.NewRequest("GET", "http://something.local/someurl", strings.NewReader("body"))
+	req = http_retry.Override(req, http_retry.WithMax(2))
+	req = http_retry.Override(req, http_retry.WithResponseDiscarder(func(resp *http.Response) bool {
+		return resp.StatusCode == 404
+	}))
+	resp, err := client.Do(req)
+	require.NoError(t, err, "call shouldn't fail")
+	resp.Body.Close()
+	assert.Equal(t, 404, resp.StatusCode, "both the discarder and the max overrides must apply")
+	calls, _, _ := transport.stats()
+	assert.Equal(t, 2, calls, "the earlier max override must still apply")
+}
+
+func TestDisableTakesPrecedenceOverEnable(t *testing.T) {
+	transport := &hedgingTransport{delays: []time.Duration{0}, codes: []int{503}}
+	client := overrideClient(transport)
+	req, _ := http.NewRequest("GET", "http://something.local/someurl", strings.NewReader("body"))
+	resp, err := client.Do(http_retry.Disable(http_retry.Enable(req)))
+	require.NoError(t, err, "call shouldn't fail")
+	resp.Body.Close()
+	calls, _, _ := transport.stats()
+	assert.Equal(t, 1, calls, "disabled requests must not be retried")
+}
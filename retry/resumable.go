@@ -0,0 +1,117 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_retry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/mwitkow/go-httpwares/internal"
+	"github.com/mwitkow/go-httpwares/tags"
+)
+
+// withResumableBody wraps the body of the response, so that reads failing midway are resumed with Range requests.
+//
+// Only full responses to GET requests, for resources with a strong ETag that the server can serve in byte ranges, are
+// resumable. Other responses are returned untouched.
+func withResumableBody(next http.RoundTripper, req *http.Request, resp *http.Response, o *options) *http.Response {
+	if resp == nil || o.maxResumes == 0 || req.Method != "GET" || resp.StatusCode != http.StatusOK {
+		return resp
+	}
+	if req.Header.Get("Range") != "" || resp.Uncompressed {
+		return resp // the offsets wouldn't match the ranges of the resource.
+	}
+	etag := resp.Header.Get("ETag")
+	if etag == "" || strings.HasPrefix(etag, "W/") || !strings.Contains(resp.Header.Get("Accept-Ranges"), "bytes") {
+		return resp
+	}
+	resp.Body = &resumableBody{
+		next:   next,
+		req:    req,
+		opts:   o,
+		etag:   etag,
+		body:   resp.Body,
+		cancel: func() {},
+	}
+	return resp
+}
+
+// resumableBody is a response body that issues `Range` requests to continue reading after failures.
+type resumableBody struct {
+	next    http.RoundTripper
+	req     *http.Request
+	opts    *options
+	etag    string
+	offset  int64
+	resumes uint
+	// budgetExhausted is set once the retry budget didn't allow a resume, no more are made after that.
+	budgetExhausted bool
+
+	body   io.ReadCloser
+	cancel context.CancelFunc // of the context of the last resume.
+}
+
+func (b *resumableBody) Read(p []byte) (int, error) {
+	for {
+		n, err := b.body.Read(p)
+		b.offset += int64(n)
+		if err == nil || err == io.EOF || b.resumes >= b.opts.maxResumes || b.budgetExhausted || b.req.Context().Err() != nil {
+			return n, err
+		}
+		if resumeErr := b.resume(); resumeErr != nil {
+			return n, err // the original error is what the caller is interested in.
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+func (b *resumableBody) Close() error {
+	err := b.body.Close()
+	b.cancel()
+	return err
+}
+
+// resume replaces the body with the rest of the resource, requested from the current offset.
+func (b *resumableBody) resume() error {
+	if b.opts.budget != nil && !b.opts.budget.withdraw(http_ctxtags.ServiceName(b.req)) {
+		b.budgetExhausted = true
+		return fmt.Errorf("retry budget exhausted")
+	}
+	b.resumes++
+	ctx, cancel := attemptContext(b.req.Context(), b.opts)
+	resumeTags := http_ctxtags.ExtractOutbound(b.req).Copy().Set(TagForRetryReason, RetryReasonResume)
+	resumeReq, err := newAttemptRequest(b.req, http_ctxtags.SetOutboundInContext(ctx, resumeTags))
+	if err != nil {
+		cancel()
+		return err
+	}
+	resumeReq.Header = make(http.Header, len(b.req.Header)+2)
+	for k, v := range b.req.Header {
+		resumeReq.Header[k] = v
+	}
+	resumeReq.Header.Set("Range", fmt.Sprintf("bytes=%d-", b.offset))
+	resumeReq.Header.Set("If-Range", b.etag)
+	resp, err := b.next.RoundTrip(resumeReq)
+	if err != nil {
+		cancel()
+		return err
+	}
+	// If the resource changed, the server responds with the whole new one instead.
+	if resp.StatusCode != http.StatusPartialContent ||
+		!strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", b.offset)) {
+		http_internal.DrainAndClose(resp)
+		cancel()
+		return fmt.Errorf("resource can't be resumed, got status %d", resp.StatusCode)
+	}
+	b.body.Close()
+	b.cancel()
+	b.body = resp.Body
+	b.cancel = cancel
+	return nil
+}
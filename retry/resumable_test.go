@@ -0,0 +1,119 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_retry_test
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/retry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const resumableContent = "0123456789abcdefghij"
+
+// failingReader returns an error after reading a given number of bytes.
+type failingReader struct {
+	io.Reader
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	n, err := f.Reader.Read(p)
+	if err == io.EOF {
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// rangeTransport is a fake RoundTripper serving resumableContent, failing each body after failAfter bytes.
+type rangeTransport struct {
+	failAfter  int
+	etag       string
+	changed    bool
+	rangeHdrs  []string
+	ifRangeHdr []string
+}
+
+func (r *rangeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Request: req}
+	resp.Header.Set("Accept-Ranges", "bytes")
+	resp.Header.Set("ETag", r.etag)
+	start := 0
+	if rangeHdr := req.Header.Get("Range"); rangeHdr != "" {
+		r.rangeHdrs = append(r.rangeHdrs, rangeHdr)
+		r.ifRangeHdr = append(r.ifRangeHdr, req.Header.Get("If-Range"))
+		if !r.changed && req.Header.Get("If-Range") == r.etag {
+			start, _ = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rangeHdr, "bytes="), "-"))
+			resp.StatusCode = http.StatusPartialContent
+			resp.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(resumableContent)-1, len(resumableContent)))
+		}
+	}
+	end := start + r.failAfter
+	if end >= len(resumableContent) {
+		resp.Body = ioutil.NopCloser(strings.NewReader(resumableContent[start:]))
+	} else {
+		resp.Body = ioutil.NopCloser(&failingReader{strings.NewReader(resumableContent[start:end])})
+	}
+	return resp, nil
+}
+
+func resumableGet(t *testing.T, transport http.RoundTripper, maxResumes uint, opts ...http_retry.Option) (string, error) {
+	client := httpwares.TripperwareChain{
+		http_retry.Tripperware(append(opts, http_retry.WithResumableBody(maxResumes))...),
+	}.WrapClient(&http.Client{Transport: transport})
+	req, _ := http.NewRequest("GET", "http://something.local/large", nil)
+	resp, err := client.Do(req)
+	require.NoError(t, err, "call shouldn't fail")
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	return string(data), err
+}
+
+func TestResumableBodyContinuesAfterFailure(t *testing.T) {
+	transport := &rangeTransport{failAfter: 8, etag: `"v1"`}
+	data, err := resumableGet(t, transport, 3)
+	require.NoError(t, err, "the failed reads must be resumed")
+	assert.Equal(t, resumableContent, data, "the whole content must be read")
+	assert.Equal(t, []string{"bytes=8-", "bytes=16-"}, transport.rangeHdrs, "the reads must resume at the offset")
+	assert.Equal(t, []string{`"v1"`, `"v1"`}, transport.ifRangeHdr, "the resumes must be conditional on the ETag")
+}
+
+func TestResumableBodyGivesUpAfterMaxResumes(t *testing.T) {
+	transport := &rangeTransport{failAfter: 4, etag: `"v1"`}
+	data, err := resumableGet(t, transport, 2)
+	assert.Equal(t, io.ErrUnexpectedEOF, err, "the read must fail after the max resumes")
+	assert.Equal(t, resumableContent[:12], data, "the content before the failure must be read")
+	assert.Len(t, transport.rangeHdrs, 2, "only the max resumes must be made")
+}
+
+func TestResumableBodyStopsWhenBudgetIsExhausted(t *testing.T) {
+	budget := http_retry.NewBudget(0, 0, 1)
+	transport := &rangeTransport{failAfter: 4, etag: `"v1"`}
+	data, err := resumableGet(t, transport, 3, http_retry.WithBudget(budget))
+	assert.Equal(t, io.ErrUnexpectedEOF, err, "the read must fail once the budget is exhausted")
+	assert.Equal(t, resumableContent[:8], data, "the content before the failure must be read")
+	assert.Len(t, transport.rangeHdrs, 1, "resumes must be taken out of the budget")
+	assert.EqualValues(t, 1, budget.Stats()["something.local"].RetriesSkipped, "the skipped resume must be recorded")
+}
+
+func TestResumableBodyIsNotResumedForWeakETag(t *testing.T) {
+	transport := &rangeTransport{failAfter: 8, etag: `W/"v1"`}
+	_, err := resumableGet(t, transport, 3)
+	assert.Equal(t, io.ErrUnexpectedEOF, err, "the read must fail")
+	assert.Empty(t, transport.rangeHdrs, "weak ETags must not be resumed")
+}
+
+func TestResumableBodyFailsWhenResourceChanged(t *testing.T) {
+	transport := &rangeTransport{failAfter: 8, etag: `"v1"`, changed: true}
+	data, err := resumableGet(t, transport, 3)
+	assert.Equal(t, io.ErrUnexpectedEOF, err, "the read must fail")
+	assert.Equal(t, resumableContent[:8], data, "the content of a changed resource must not be mixed in")
+}
@@ -0,0 +1,89 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_retry_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/retry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// throttlingTransport is a fake RoundTripper that throttles the first requests with the given Retry-After.
+type throttlingTransport struct {
+	mu         sync.Mutex
+	throttled  int
+	retryAfter string
+	callTimes  []time.Time
+}
+
+func (f *throttlingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.callTimes = append(f.callTimes, time.Now())
+	resp := &http.Response{StatusCode: 200, Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader("")), Request: req}
+	if len(f.callTimes) <= f.throttled {
+		resp.StatusCode = http.StatusTooManyRequests
+		resp.Header.Set("Retry-After", f.retryAfter)
+	}
+	return resp, nil
+}
+
+func (f *throttlingTransport) calls() []time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.callTimes
+}
+
+func throttledClient(transport http.RoundTripper, opts ...http_retry.Option) *http.Client {
+	opts = append([]http_retry.Option{http_retry.WithMax(3), http_retry.WithBackoff(http_retry.BackoffLinear(time.Hour))}, opts...)
+	return httpwares.TripperwareChain{http_retry.Tripperware(opts...)}.WrapClient(&http.Client{Transport: transport})
+}
+
+func TestRetryAfterSecondsIsCappedAtMax(t *testing.T) {
+	transport := &throttlingTransport{throttled: 1, retryAfter: "120"}
+	client := throttledClient(transport, http_retry.WithMaxRetryAfter(20*time.Millisecond))
+	req, _ := http.NewRequest("GET", "http://something.local/someurl", strings.NewReader("body"))
+	resp, err := client.Do(req)
+	require.NoError(t, err, "call shouldn't fail")
+	assert.Equal(t, 200, resp.StatusCode, "the throttled request must be retried")
+	calls := transport.calls()
+	require.Len(t, calls, 2, "the throttled request must be retried once")
+	waited := calls[1].Sub(calls[0])
+	assert.True(t, waited >= 20*time.Millisecond && waited < time.Second, "the wait %v must be capped by the max instead of using backoff", waited)
+}
+
+func TestRetryAfterHttpDateInThePastRetriesImmediately(t *testing.T) {
+	transport := &throttlingTransport{throttled: 2, retryAfter: time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)}
+	client := throttledClient(transport)
+	req, _ := http.NewRequest("GET", "http://something.local/someurl", strings.NewReader("body"))
+	resp, err := client.Do(req)
+	require.NoError(t, err, "call shouldn't fail")
+	assert.Equal(t, 200, resp.StatusCode, "the throttled request must be retried")
+	calls := transport.calls()
+	require.Len(t, calls, 3, "the throttled request must be retried twice")
+	assert.True(t, calls[2].Sub(calls[0]) < time.Second, "the date in the past must not make us wait")
+}
+
+func TestRetryAfterPastDeadlineReturnsLastResponse(t *testing.T) {
+	transport := &throttlingTransport{throttled: 1, retryAfter: "5"}
+	client := throttledClient(transport)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequest("GET", "http://something.local/someurl", strings.NewReader("body"))
+	startTime := time.Now()
+	resp, err := client.Do(req.WithContext(ctx))
+	require.NoError(t, err, "call shouldn't fail, the last response should be returned instead")
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode, "the throttled response must be returned")
+	assert.True(t, time.Since(startTime) < 250*time.Millisecond, "we should give up without waiting for the deadline")
+	assert.Len(t, transport.calls(), 1, "no retry should be made")
+}
@@ -0,0 +1,33 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_retry
+
+const (
+	// TagForRetryAttempt is a string naming the ctxtag with the number of the attempt, starting at 1, in its own tags.
+	TagForRetryAttempt = "http.retry.attempt"
+	// TagForRetryReason is a string naming the ctxtag with the reason an attempt was made, in its own tags.
+	TagForRetryReason = "http.retry.reason"
+	// TagForRetryAttempts is a string naming the ctxtag with the total number of attempts, in the tags of the request.
+	TagForRetryAttempts = "http.retry.attempts"
+	// TagForRetrySkipped is a string naming the ctxtag set when retries of a request were skipped, with the reason.
+	TagForRetrySkipped = "http.retry.skipped"
+)
+
+const (
+	// SkippedBodyNotReplayable is the value of TagForRetrySkipped for requests without `GetBody`, see `WithBufferedBody`.
+	SkippedBodyNotReplayable = "body_not_replayable"
+	// SkippedBodyTooLarge is the value of TagForRetrySkipped for requests with bodies too large to buffer.
+	SkippedBodyTooLarge = "body_too_large"
+)
+
+const (
+	// RetryReasonError is the value of TagForRetryReason for attempts made after the previous one failed with an error.
+	RetryReasonError = "error"
+	// RetryReasonDiscardedStatus is the value of TagForRetryReason for attempts made after a discarded response.
+	RetryReasonDiscardedStatus = "discarded_status"
+	// RetryReasonHedge is the value of TagForRetryReason for hedged attempts sent after the hedging delay.
+	RetryReasonHedge = "hedge"
+	// RetryReasonResume is the value of TagForRetryReason for `Range` requests resuming a failed read of the body.
+	RetryReasonResume = "resume"
+)
@@ -0,0 +1,85 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_retry_test
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/retry"
+	"github.com/mwitkow/go-httpwares/tags"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tagRecordingTripperware records the outbound tags of every request passing through it.
+type tagRecordingTripperware struct {
+	mu   sync.Mutex
+	tags []map[string]interface{}
+}
+
+func (r *tagRecordingTripperware) wrap(next http.RoundTripper) http.RoundTripper {
+	return httpwares.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		r.mu.Lock()
+		r.tags = append(r.tags, http_ctxtags.ExtractOutbound(req).Values())
+		r.mu.Unlock()
+		return next.RoundTrip(req)
+	})
+}
+
+func TestAttemptsAreTagged(t *testing.T) {
+	transport := &hedgingTransport{delays: []time.Duration{0}, codes: []int{503, 200}}
+	inner, outer := &tagRecordingTripperware{}, &tagRecordingTripperware{}
+	var outerReq *http.Request
+	client := httpwares.TripperwareChain{
+		http_ctxtags.Tripperware(http_ctxtags.WithServiceName("flaky")),
+		func(next http.RoundTripper) http.RoundTripper {
+			return httpwares.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				outerReq = req
+				return next.RoundTrip(req)
+			})
+		},
+		outer.wrap,
+		http_retry.Tripperware(http_retry.WithMax(3), http_retry.WithBackoff(http_retry.BackoffLinear(0))),
+		inner.wrap,
+	}.WrapClient(&http.Client{Transport: transport})
+	req, _ := http.NewRequest("GET", "http://something.local/someurl", nil)
+	resp, err := client.Do(req)
+	require.NoError(t, err, "call shouldn't fail")
+	resp.Body.Close()
+
+	require.Len(t, inner.tags, 2, "each attempt must be seen separately")
+	assert.Equal(t, 1, inner.tags[0][http_retry.TagForRetryAttempt], "the first attempt must be numbered")
+	assert.NotContains(t, inner.tags[0], http_retry.TagForRetryReason, "the first attempt is not a retry")
+	assert.Equal(t, 2, inner.tags[1][http_retry.TagForRetryAttempt], "the retry must be numbered")
+	assert.Equal(t, http_retry.RetryReasonDiscardedStatus, inner.tags[1][http_retry.TagForRetryReason], "the retry reason must be tagged")
+	assert.Equal(t, "flaky", inner.tags[1][http_ctxtags.TagForCallService], "attempts must keep the tags of the request")
+
+	requestTags := http_ctxtags.ExtractOutbound(outerReq).Values()
+	assert.Equal(t, 2, requestTags[http_retry.TagForRetryAttempts], "the total number of attempts must be tagged")
+	assert.NotContains(t, requestTags, http_retry.TagForRetryAttempt, "attempt tags must not leak into the request")
+}
+
+func TestHedgedAttemptsAreTagged(t *testing.T) {
+	transport := &hedgingTransport{delays: []time.Duration{time.Second, time.Millisecond}, codes: []int{200}}
+	inner := &tagRecordingTripperware{}
+	client := httpwares.TripperwareChain{
+		http_ctxtags.Tripperware(),
+		http_retry.Tripperware(http_retry.WithMax(3), http_retry.WithHedgingDelay(10*time.Millisecond)),
+		inner.wrap,
+	}.WrapClient(&http.Client{Transport: transport})
+	req, _ := http.NewRequest("GET", "http://something.local/someurl", nil)
+	resp, err := client.Do(req)
+	require.NoError(t, err, "call shouldn't fail")
+	resp.Body.Close()
+
+	inner.mu.Lock()
+	defer inner.mu.Unlock()
+	require.Len(t, inner.tags, 2, "one hedged attempt must be sent")
+	assert.Equal(t, 2, inner.tags[1][http_retry.TagForRetryAttempt], "the hedged attempt must be numbered")
+	assert.Equal(t, http_retry.RetryReasonHedge, inner.tags[1][http_retry.TagForRetryReason], "the hedge must be tagged")
+}
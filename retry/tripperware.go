@@ -4,54 +4,125 @@
 package http_retry
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/internal"
+	"github.com/mwitkow/go-httpwares/tags"
 )
 
 // Tripperware is client side HTTP ware that retries the requests.
 //
 // Be default this retries safe and idempotent requests 3 times with a linear delay of 100ms. This behaviour can be
-// customized using With* parameter options.
+// customized using With* parameter options. If the server returns a `Retry-After` header, it is used in place of the
+// backoff delay (see `WithMaxRetryAfter`). The number of retries across requests can be limited using `WithBudget`.
 //
-// Requests that have `http_retry.Enable` set on them will always be retried.
+// Requests that have `http_retry.Enable` set on them will always be retried, and ones that have `http_retry.Disable` set
+// will never be. The options can be changed for a single request using `http_retry.Override`.
+//
+// Every attempt is made with a copy of the outbound `http_ctxtags.Tags`, marked with the attempt number and the reason
+// for retrying. The total number of attempts is recorded in the tags of the request. Place `http_logrus.Tripperware` or
+// `http_opentracing.Tripperware` after this Tripperware to log or trace each attempt separately.
+//
+// If hedging is configured (see `WithHedgingDelay` and `WithHedgingPercentile`), the attempts are not sequential but
+// hedged: additional attempts are sent without cancelling the ones in flight.
 func Tripperware(opts ...Option) httpwares.Tripperware {
 	return func(next http.RoundTripper) http.RoundTripper {
-		o := evaluateOptions(opts)
+		tripperOpts := evaluateOptions(opts)
+		hedger := newHedger()
 		return httpwares.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if isDisabled(req.Context()) {
+				return next.RoundTrip(req)
+			}
+			o := tripperOpts.withOverrides(overridesFromContext(req.Context()))
 			// Short-circuit to avoid allocations.
 			if !o.decider(req) && !isEnabled(req.Context()) {
 				return next.RoundTrip(req)
 			}
-			if o.maxRetry == 0 || req.GetBody == nil {
-				// If we are configured to do no retries or the lack of GetBody function doesn't allow for re-reads of
-				// body data.
+			if o.maxRetry == 0 {
 				return next.RoundTrip(req)
 			}
+			if !http_internal.IsReplayable(req) {
+				// The lack of GetBody function doesn't allow for re-reads of body data, unless we buffer it ourselves.
+				if o.bufferedBodyMax <= 0 {
+					http_ctxtags.ExtractOutbound(req).Set(TagForRetrySkipped, SkippedBodyNotReplayable)
+					return next.RoundTrip(req)
+				}
+				bufReq, ok, err := bufferBody(req, o.bufferedBodyMax)
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					http_ctxtags.ExtractOutbound(req).Set(TagForRetrySkipped, SkippedBodyTooLarge)
+					return next.RoundTrip(bufReq)
+				}
+				req = bufReq
+			}
+			if o.budget != nil {
+				o.budget.deposit(http_ctxtags.ServiceName(req))
+			}
+			if o.hedgingEnabled() {
+				resp, err := hedger.RoundTrip(next, req, o)
+				return withResumableBody(next, req, resp, o), err
+			}
+			tags := http_ctxtags.ExtractOutbound(req)
+			attemptsMade := 0
+			defer func() {
+				tags.Set(TagForRetryAttempts, attemptsMade)
+			}()
 			var err error
 			var lastResp *http.Response
+			lastCancel := context.CancelFunc(func() {})
+			reason := ""
 			for attempt := uint(0); attempt < o.maxRetry; attempt++ {
-				thisReq := req.WithContext(req.Context()) // make a copy.
-				thisReq.Body, err = req.GetBody()
-				if err != nil {
-					return nil, fmt.Errorf("failed reading body for retry: %v", err)
+				if attempt > 0 {
+					waitTime, giveUp := retryWaitTime(attempt, lastResp, req.Context(), o)
+					if giveUp {
+						break // the server asked us to wait past our deadline, return what it said.
+					}
+					if o.budget != nil && !o.budget.withdraw(http_ctxtags.ServiceName(req)) {
+						break // the retry budget is exhausted, return the last response or error.
+					}
+					http_internal.DrainAndClose(lastResp) // the response is discarded, release the connection.
+					lastCancel()
+					if err := waitRetryBackoff(waitTime, req.Context()); err != nil {
+						return nil, err // context errors from req.Context()
+					}
 				}
-				if err := waitRetryBackoff(attempt, req.Context(), o); err != nil {
-					return nil, err // context errors from req.Context()
+				attemptCtx, cancel := attemptContext(req.Context(), o)
+				lastCancel = cancel
+				var thisReq *http.Request
+				thisReq, err = newAttemptRequest(req, withAttemptTags(attemptCtx, tags, attempt, reason))
+				if err != nil {
+					cancel()
+					return nil, err
 				}
 				lastResp, err = next.RoundTrip(thisReq)
-				if isContextError(err) {
-					break // do not retry context errors
+				attemptsMade++
+				reason = retryReason(err)
+				if req.Context().Err() != nil {
+					break // the parent context is done, there's no time left for retries.
+				} else if isContextError(err) && attemptCtx.Err() == nil {
+					break // do not retry context errors, unless the attempt timed out.
 				} else if err == nil && !o.discarder(lastResp) {
 					break // do not retry responses that the discarder tells us we should not discard
 				}
 			}
 			if lastResp != nil {
-				return lastResp, err
-			} else if err != nil {
+				if o.perAttemptTimeout > 0 {
+					lastResp.Body = &cancelOnCloseBody{ReadCloser: lastResp.Body, cancel: lastCancel}
+				}
+				return withResumableBody(next, req, lastResp, o), err
+			}
+			lastCancel()
+			if err != nil {
 				return nil, err
 			}
 			return nil, fmt.Errorf("maximum retry budget of %d reached", o.maxRetry)
@@ -59,16 +130,129 @@ func Tripperware(opts ...Option) httpwares.Tripperware {
 	}
 }
 
-func waitRetryBackoff(attempt uint, parentCtx context.Context, opt *options) error {
-	var waitTime time.Duration = 0
-	if attempt > 0 {
-		waitTime = opt.backoffFunc(attempt)
+// withAttemptTags returns the context of an attempt with a copy of the request's tags, marked with the attempt number
+// and the reason for making it.
+func withAttemptTags(ctx context.Context, tags *http_ctxtags.Tags, attempt uint, reason string) context.Context {
+	attemptTags := tags.Copy().Set(TagForRetryAttempt, int(attempt)+1)
+	if reason != "" {
+		attemptTags.Set(TagForRetryReason, reason)
+	}
+	return http_ctxtags.SetOutboundInContext(ctx, attemptTags)
+}
+
+// retryReason returns the reason for retrying an attempt that returned the given error, or a discarded response.
+func retryReason(err error) string {
+	if err != nil {
+		return RetryReasonError
+	}
+	return RetryReasonDiscardedStatus
+}
+
+// attemptContext returns the context for a single attempt, limited by the per-attempt timeout if one is set.
+func attemptContext(parentCtx context.Context, o *options) (context.Context, context.CancelFunc) {
+	if o.perAttemptTimeout > 0 {
+		return context.WithTimeout(parentCtx, o.perAttemptTimeout)
+	}
+	return parentCtx, func() {}
+}
+
+// bufferBody reads the body of the request into memory, returning a copy of the request that can be replayed.
+//
+// If the body is larger than maxBytes, the returned request streams the whole body through and false is returned.
+func bufferBody(req *http.Request, maxBytes int64) (*http.Request, bool, error) {
+	buf, err := ioutil.ReadAll(io.LimitReader(req.Body, maxBytes+1))
+	if err != nil {
+		req.Body.Close()
+		return nil, false, fmt.Errorf("failed buffering body for retry: %v", err)
+	}
+	bufReq := req.WithContext(req.Context()) // make a copy.
+	if int64(len(buf)) > maxBytes {
+		bufReq.Body = &readCloser{Reader: io.MultiReader(bytes.NewReader(buf), req.Body), Closer: req.Body}
+		return bufReq, false, nil
+	}
+	req.Body.Close()
+	bufReq.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(buf)), nil
+	}
+	bufReq.Body, _ = bufReq.GetBody()
+	return bufReq, true, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// newAttemptRequest makes a copy of the request for a single attempt, with a fresh copy of the body.
+func newAttemptRequest(req *http.Request, ctx context.Context) (*http.Request, error) {
+	attemptReq := req.WithContext(ctx) // make a copy.
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("failed reading body for retry: %v", err)
+		}
+		attemptReq.Body = body
+	}
+	return attemptReq, nil
+}
+
+// retryWaitTime returns the time to wait before the given attempt, and whether the retries should be given up on.
+//
+// The `Retry-After` header of the last response takes precedence over the `BackoffFunc`. If honouring it would exceed
+// the deadline of the request, there is no point in waiting.
+func retryWaitTime(attempt uint, lastResp *http.Response, parentCtx context.Context, opt *options) (time.Duration, bool) {
+	if waitTime, giveUp, ok := retryAfter(lastResp, parentCtx, opt); ok {
+		return waitTime, giveUp
+	}
+	return opt.backoffFunc(attempt), false
+}
+
+// retryAfter returns the time the server asked to wait for with a `Retry-After` header, capped at the max, and whether
+// the retries should be given up on. It returns false if the server didn't ask to wait.
+func retryAfter(lastResp *http.Response, parentCtx context.Context, opt *options) (time.Duration, bool, bool) {
+	if lastResp == nil || opt.maxRetryAfter <= 0 {
+		return 0, false, false
+	}
+	waitTime, ok := parseRetryAfter(lastResp.Header.Get("Retry-After"), time.Now())
+	if !ok {
+		return 0, false, false
+	}
+	if waitTime > opt.maxRetryAfter {
+		waitTime = opt.maxRetryAfter
+	}
+	if deadline, ok := parentCtx.Deadline(); ok && time.Now().Add(waitTime).After(deadline) {
+		return 0, true, true
 	}
+	return waitTime, false, true
+}
+
+// parseRetryAfter parses the value of a `Retry-After` header, in either the delta-seconds or the HTTP-date form.
+//
+// See https://tools.ietf.org/html/rfc7231#section-7.1.3
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if waitTime := date.Sub(now); waitTime > 0 {
+			return waitTime, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func waitRetryBackoff(waitTime time.Duration, parentCtx context.Context) error {
 	if waitTime > 0 {
+		timer := time.NewTimer(waitTime)
+		defer timer.Stop()
 		select {
 		case <-parentCtx.Done():
 			return parentCtx.Err()
-		case <-time.Tick(waitTime):
+		case <-timer.C:
 		}
 	}
 	return nil
@@ -0,0 +1,27 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+/*
+`http_shedding` is a HTTP server-side Middleware that rejects requests early when the server is overloaded.
+
+When a server is overloaded, all handlers slow down together. Instead, a `Shedder` limits the number of requests
+handled at once. Requests over the limit wait in a queue for a free slot, and if they don't get one within the queue
+timeout, they are shed: rejected with 503 and a `Retry-After` header, before any work is done on them.
+
+Thresholds
+
+The limit is either fixed (`WithMaxInFlight`) or adapted to the latency and the errors of the handlers, using any of
+the `http_adaptive.Limit` algorithms (`WithAdaptiveLimit`).
+
+Priorities
+
+Every request has a `Priority` decided from its inbound `http_ctxtags.Tags`, e.g. by the handler group with
+`PriorityByTag`. Waiting critical requests get free slots before normal ones, and low priority requests are shed
+straight away instead of waiting. The Middleware needs to be placed after `http_ctxtags.Middleware` in the chain. To
+decide the priority by handler names, it needs to be placed after `http_ctxtags.HandlerName` around each handler, sharing
+the same Shedder.
+
+Shed requests have the `http.shedding.shed` tag set, and queued ones have the time they waited recorded in the
+`http.shedding.queue_ms` tag, so that logging and tracing middleware can show them.
+*/
+package http_shedding
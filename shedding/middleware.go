@@ -0,0 +1,55 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_shedding
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/adaptive"
+	"github.com/mwitkow/go-httpwares/internal"
+	"github.com/mwitkow/go-httpwares/tags"
+)
+
+const (
+	// TagForShed is a string naming the ctxtag set on requests that were shed.
+	TagForShed = "http.shedding.shed"
+	// TagForQueueTime is a string naming the ctxtag with the time in milliseconds a request waited in the queue.
+	TagForQueueTime = "http.shedding.queue_ms"
+)
+
+// Middleware returns a http.Handler middleware that sheds requests when the server is overloaded.
+func Middleware(s *Shedder) httpwares.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			t := http_ctxtags.ExtractInbound(req)
+			queueStart := time.Now()
+			inFlight, queued, ok := s.admit(req.Context(), s.opts.priorityFunc(t))
+			if queued {
+				t.Set(TagForQueueTime, http_internal.TimeDiffToMilliseconds(queueStart))
+			}
+			startTime := s.opts.clock()
+			if !ok {
+				t.Set(TagForShed, true)
+				resp.Header().Set("Retry-After", fmt.Sprintf("%d", int(math.Ceil(s.opts.retryAfter.Seconds()))))
+				http.Error(resp, "server overloaded, please retry later", http.StatusServiceUnavailable)
+				return
+			}
+			wrapped := httpwares.WrapResponseWriter(resp)
+			defer func() {
+				now := s.opts.clock()
+				s.done(http_adaptive.Sample{
+					RTT:      now.Sub(startTime),
+					InFlight: inFlight,
+					Dropped:  wrapped.StatusCode() >= 500,
+					Time:     now,
+				})
+			}()
+			next.ServeHTTP(wrapped, req)
+		})
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_shedding
+
+import (
+	"time"
+
+	"github.com/mwitkow/go-httpwares/adaptive"
+	"github.com/mwitkow/go-httpwares/tags"
+)
+
+var (
+	defaultOptions = &options{
+		maxInFlight:  1000,
+		queueSize:    1000,
+		queueTimeout: 100 * time.Millisecond,
+		retryAfter:   time.Second,
+		priorityFunc: func(*http_ctxtags.Tags) Priority { return PriorityNormal },
+		clock:        time.Now,
+	}
+)
+
+type options struct {
+	maxInFlight   int
+	adaptiveLimit http_adaptive.Limit
+	queueSize     int
+	queueTimeout  time.Duration
+	retryAfter    time.Duration
+	priorityFunc  PriorityFunc
+	clock         func() time.Time
+}
+
+func evaluateOptions(opts []Option) *options {
+	optCopy := &options{}
+	*optCopy = *defaultOptions
+	for _, o := range opts {
+		o(optCopy)
+	}
+	return optCopy
+}
+
+type Option func(*options)
+
+// Priority decides the order in which waiting requests are handled, and whether they can wait at all.
+type Priority int
+
+const (
+	// PriorityLow requests are shed straight away when the server is at its limit.
+	PriorityLow Priority = iota
+	// PriorityNormal requests wait in the queue, after the critical ones.
+	PriorityNormal
+	// PriorityCritical requests wait in the queue, regardless of its size, and are handled first.
+	PriorityCritical
+)
+
+// PriorityFunc decides the priority of a request from its inbound tags.
+type PriorityFunc func(tags *http_ctxtags.Tags) Priority
+
+// PriorityByTag returns a PriorityFunc deciding the priority by the value of the given tag, e.g. the handler group.
+//
+// Requests with values missing from the map have normal priority.
+func PriorityByTag(tag string, priorities map[string]Priority) PriorityFunc {
+	return func(tags *http_ctxtags.Tags) Priority {
+		if value, ok := tags.Values()[tag].(string); ok {
+			if priority, ok := priorities[value]; ok {
+				return priority
+			}
+		}
+		return PriorityNormal
+	}
+}
+
+// WithMaxInFlight sets a fixed limit of the requests handled at once, 1000 by default.
+func WithMaxInFlight(max int) Option {
+	return func(o *options) {
+		o.maxInFlight = max
+	}
+}
+
+// WithAdaptiveLimit makes the limit of the requests handled at once adapt to the latency and the errors of handlers.
+//
+// The latency is measured from when the request is admitted until the handler returns, and 5xx responses count as
+// dropped requests. The Limit is used only by this Shedder and must not be shared.
+func WithAdaptiveLimit(limit http_adaptive.Limit) Option {
+	return func(o *options) {
+		o.adaptiveLimit = limit
+	}
+}
+
+// WithQueue sets the maximum number of requests waiting for a free slot, and the time they can wait for.
+//
+// By default at most 1000 requests wait for at most 100 milliseconds. Setting the size to 0 sheds all requests over the
+// limit straight away, apart from the critical ones.
+func WithQueue(size int, timeout time.Duration) Option {
+	return func(o *options) {
+		o.queueSize = size
+		o.queueTimeout = timeout
+	}
+}
+
+// WithRetryAfter sets the time sent to the clients of shed requests in the `Retry-After` header, 1 second by default.
+func WithRetryAfter(d time.Duration) Option {
+	return func(o *options) {
+		o.retryAfter = d
+	}
+}
+
+// WithPriorityFunc sets the function deciding the priority of requests, by default all requests are of normal priority.
+func WithPriorityFunc(f PriorityFunc) Option {
+	return func(o *options) {
+		o.priorityFunc = f
+	}
+}
+
+// WithClock sets the source of time used for measuring latency, meant for tests.
+func WithClock(now func() time.Time) Option {
+	return func(o *options) {
+		o.clock = now
+	}
+}
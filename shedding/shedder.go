@@ -0,0 +1,135 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_shedding
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mwitkow/go-httpwares/adaptive"
+)
+
+// Shedder keeps track of the requests handled and waiting, deciding which ones to shed.
+//
+// A single Shedder is meant to be shared between all the Middleware of a server, and is safe for concurrent use.
+type Shedder struct {
+	opts *options
+
+	mu       sync.Mutex
+	inFlight int
+	waiters  [PriorityCritical + 1][]chan struct{}
+	queued   int
+	shed     uint64
+}
+
+// Stats is a snapshot of the state of the Shedder, meant for metrics.
+type Stats struct {
+	// Limit is the current number of requests allowed to be handled at once.
+	Limit int
+	// InFlight is the number of requests being handled.
+	InFlight int
+	// Queued is the number of requests waiting for a free slot.
+	Queued int
+	// Shed is the total number of requests shed.
+	Shed uint64
+}
+
+// NewShedder creates a new Shedder.
+func NewShedder(opts ...Option) *Shedder {
+	return &Shedder{opts: evaluateOptions(opts)}
+}
+
+// Stats returns a snapshot of the state of the Shedder.
+func (s *Shedder) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Stats{Limit: s.limit(), InFlight: s.inFlight, Queued: s.queued, Shed: s.shed}
+}
+
+func (s *Shedder) limit() int {
+	if s.opts.adaptiveLimit != nil {
+		return s.opts.adaptiveLimit.Limit()
+	}
+	return s.opts.maxInFlight
+}
+
+// admit takes a slot for a request, waiting in the queue if needed. It returns the number of requests in flight when
+// admitted, whether the request waited in the queue, and false if the request is to be shed.
+func (s *Shedder) admit(ctx context.Context, priority Priority) (inFlight int, queued bool, ok bool) {
+	s.mu.Lock()
+	// Slots freed by the adaptive limit going up go to the queued requests first.
+	for s.inFlight < s.limit() && s.handOverLocked() {
+		s.inFlight++
+	}
+	if s.queued == 0 && s.inFlight < s.limit() {
+		s.inFlight++
+		inFlight := s.inFlight
+		s.mu.Unlock()
+		return inFlight, false, true
+	}
+	if priority == PriorityLow || (priority != PriorityCritical && s.queued >= s.opts.queueSize) {
+		s.shed++
+		s.mu.Unlock()
+		return 0, false, false
+	}
+	ready := make(chan struct{})
+	s.waiters[priority] = append(s.waiters[priority], ready)
+	s.queued++
+	s.mu.Unlock()
+
+	timer := time.NewTimer(s.opts.queueTimeout)
+	defer timer.Stop()
+	select {
+	case <-ready:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.inFlight, true, true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shed++
+	for i, w := range s.waiters[priority] {
+		if w == ready {
+			s.waiters[priority] = append(s.waiters[priority][:i], s.waiters[priority][i+1:]...)
+			s.queued--
+			return 0, true, false
+		}
+	}
+	// The slot was handed over just as we gave up, pass it on.
+	s.releaseLocked()
+	return 0, true, false
+}
+
+// done releases the slot of an admitted request, updating the adaptive limit with its outcome.
+func (s *Shedder) done(sample http_adaptive.Sample) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.opts.adaptiveLimit != nil {
+		s.opts.adaptiveLimit.Update(sample)
+	}
+	s.releaseLocked()
+}
+
+func (s *Shedder) releaseLocked() {
+	// When handed over, the number in flight stays the same.
+	if s.inFlight > s.limit() || !s.handOverLocked() {
+		s.inFlight--
+	}
+}
+
+// handOverLocked wakes the queued request of the highest priority, returning false if none is queued.
+func (s *Shedder) handOverLocked() bool {
+	for priority := PriorityCritical; priority >= PriorityLow; priority-- {
+		if len(s.waiters[priority]) > 0 {
+			close(s.waiters[priority][0])
+			s.waiters[priority] = s.waiters[priority][1:]
+			s.queued--
+			return true
+		}
+	}
+	return false
+}
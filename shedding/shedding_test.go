@@ -0,0 +1,168 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_shedding_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/adaptive"
+	"github.com/mwitkow/go-httpwares/shedding"
+	"github.com/mwitkow/go-httpwares/tags"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type result struct {
+	group string
+	resp  *httptest.ResponseRecorder
+	tags  map[string]interface{}
+}
+
+// sheddingServer serves requests of the given handler groups, blocking in the handler until unblocked.
+type sheddingServer struct {
+	shedder *http_shedding.Shedder
+	handled chan string
+	unblock chan struct{}
+	results chan *result
+}
+
+func newSheddingServer(opts ...http_shedding.Option) *sheddingServer {
+	return &sheddingServer{
+		shedder: http_shedding.NewShedder(opts...),
+		handled: make(chan string, 10),
+		unblock: make(chan struct{}),
+		results: make(chan *result, 10),
+	}
+}
+
+func (s *sheddingServer) serve(group string) {
+	res := &result{group: group, resp: httptest.NewRecorder()}
+	handler := httpwares.MiddlewareChain{
+		http_ctxtags.Middleware(group),
+		func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+				next.ServeHTTP(resp, req)
+				res.tags = http_ctxtags.ExtractInbound(req).Values()
+			})
+		},
+		http_shedding.Middleware(s.shedder),
+	}.ForgeFunc(func(resp http.ResponseWriter, req *http.Request) {
+		s.handled <- group
+		<-s.unblock
+		resp.WriteHeader(http.StatusOK)
+	})
+	handler.ServeHTTP(res.resp, httptest.NewRequest("GET", "/someurl", nil))
+	s.results <- res
+}
+
+func (s *sheddingServer) start(group string) {
+	go s.serve(group)
+}
+
+func (s *sheddingServer) waitForQueued(t *testing.T, queued int) {
+	for i := 0; i < 100 && s.shedder.Stats().Queued != queued; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	require.Equal(t, queued, s.shedder.Stats().Queued, "requests must be queued")
+}
+
+func TestMiddlewareShedsOverLimit(t *testing.T) {
+	s := newSheddingServer(http_shedding.WithMaxInFlight(1), http_shedding.WithQueue(0, 0), http_shedding.WithRetryAfter(1500*time.Millisecond))
+	s.start("api")
+	<-s.handled
+	s.serve("api")
+	shed := <-s.results
+	assert.Equal(t, http.StatusServiceUnavailable, shed.resp.Code, "requests over the limit must be shed")
+	assert.Equal(t, "2", shed.resp.Header().Get("Retry-After"), "the retry after must be rounded up to seconds")
+	assert.Equal(t, true, shed.tags[http_shedding.TagForShed], "shed requests must be tagged")
+	close(s.unblock)
+	handled := <-s.results
+	assert.Equal(t, http.StatusOK, handled.resp.Code, "requests within the limit must be handled")
+	assert.NotContains(t, handled.tags, http_shedding.TagForShed, "handled requests must not be tagged as shed")
+	assert.Equal(t, http_shedding.Stats{Limit: 1, InFlight: 0, Queued: 0, Shed: 1}, s.shedder.Stats())
+}
+
+func TestMiddlewareQueuesUntilSlotIsFree(t *testing.T) {
+	s := newSheddingServer(http_shedding.WithMaxInFlight(1), http_shedding.WithQueue(1, 5*time.Second))
+	s.start("api")
+	<-s.handled
+	s.start("api")
+	s.waitForQueued(t, 1)
+	s.serve("api")
+	shed := <-s.results
+	assert.Equal(t, http.StatusServiceUnavailable, shed.resp.Code, "requests over the queue size must be shed")
+	assert.NotContains(t, shed.tags, http_shedding.TagForQueueTime, "requests that were not queued must not be tagged")
+
+	time.Sleep(10 * time.Millisecond)
+	s.unblock <- struct{}{}
+	first := <-s.results
+	assert.Equal(t, http.StatusOK, first.resp.Code, "the first request must be handled")
+	assert.NotContains(t, first.tags, http_shedding.TagForQueueTime, "requests that were not queued must not be tagged")
+	<-s.handled
+	s.unblock <- struct{}{}
+	queued := <-s.results
+	assert.Equal(t, http.StatusOK, queued.resp.Code, "the queued request must be handled once the slot is free")
+	require.Contains(t, queued.tags, http_shedding.TagForQueueTime, "the time spent queued must be tagged")
+	assert.True(t, queued.tags[http_shedding.TagForQueueTime].(float32) >= 10, "the time spent queued must be measured")
+}
+
+func TestMiddlewareShedsAfterQueueTimeout(t *testing.T) {
+	s := newSheddingServer(http_shedding.WithMaxInFlight(1), http_shedding.WithQueue(1, 20*time.Millisecond))
+	s.start("api")
+	<-s.handled
+	s.serve("api")
+	shed := <-s.results
+	assert.Equal(t, http.StatusServiceUnavailable, shed.resp.Code, "requests queued for too long must be shed")
+	assert.Equal(t, true, shed.tags[http_shedding.TagForShed], "shed requests must be tagged")
+	assert.Contains(t, shed.tags, http_shedding.TagForQueueTime, "the time spent queued must be tagged")
+	close(s.unblock)
+	<-s.results
+}
+
+func TestMiddlewarePrioritizesByHandlerGroup(t *testing.T) {
+	s := newSheddingServer(
+		http_shedding.WithMaxInFlight(1),
+		http_shedding.WithQueue(10, 5*time.Second),
+		http_shedding.WithPriorityFunc(http_shedding.PriorityByTag(http_ctxtags.TagForHandlerGroup, map[string]http_shedding.Priority{
+			"admin": http_shedding.PriorityCritical,
+			"batch": http_shedding.PriorityLow,
+		})),
+	)
+	s.start("api")
+	<-s.handled
+	s.serve("batch")
+	shed := <-s.results
+	assert.Equal(t, http.StatusServiceUnavailable, shed.resp.Code, "low priority requests must be shed without queueing")
+
+	s.start("api")
+	s.waitForQueued(t, 1)
+	s.start("admin")
+	s.waitForQueued(t, 2)
+	close(s.unblock)
+	assert.Equal(t, "admin", <-s.handled, "critical requests must be handled first")
+	assert.Equal(t, "api", <-s.handled, "normal requests must be handled after critical ones")
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, (<-s.results).resp.Code, "queued requests must be handled")
+	}
+}
+
+func TestMiddlewareAdaptsLimitToLatency(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	shedder := http_shedding.NewShedder(
+		http_shedding.WithAdaptiveLimit(http_adaptive.NewAIMDLimit(4, 1, 10, 0.5, 100*time.Millisecond)),
+		http_shedding.WithClock(func() time.Time { return now }),
+	)
+	handler := http_shedding.Middleware(shedder)(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		now = now.Add(time.Second)
+	}))
+	assert.Equal(t, 4, shedder.Stats().Limit, "the limit must start at the initial value")
+	for i := 0; i < 2; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/someurl", nil))
+	}
+	assert.Equal(t, 1, shedder.Stats().Limit, "slow handlers must decrease the limit")
+}
@@ -8,14 +8,17 @@ import (
 	"net/http"
 )
 
-type ctxMarker struct{}
+// ctxMarker is named, as pointers to distinct zero-sized values are not guaranteed to be different.
+type ctxMarker struct {
+	name string
+}
 
 var (
 	// serversideMarker is the Context value marker used by *all* server-side middleware.
-	serversideMarker = &ctxMarker{}
+	serversideMarker = &ctxMarker{"serverside"}
 
 	// clientsideMarker is the Context value marker used by *all* client-side tripperware.
-	clientsideMarker = &ctxMarker{}
+	clientsideMarker = &ctxMarker{"clientside"}
 )
 
 // Tags is the struct used for storing request tags between Context calls.
@@ -36,6 +39,15 @@ func (t *Tags) Has(key string) bool {
 	return ok
 }
 
+// Copy returns a new Tags object with the same values, that can be modified without affecting the original.
+func (t *Tags) Copy() *Tags {
+	values := make(map[string]interface{}, len(t.values))
+	for k, v := range t.values {
+		values[k] = v
+	}
+	return &Tags{values: values}
+}
+
 // Values returns a map of key to values.
 // Do not modify the underlying map, please use Set instead.
 func (t *Tags) Values() map[string]interface{} {
@@ -59,10 +71,10 @@ func ExtractInboundFromCtx(ctx context.Context) *Tags {
 }
 
 func setInboundInContext(ctx context.Context, tags *Tags) context.Context {
-	return context.WithValue(ctx, clientsideMarker, tags)
+	return context.WithValue(ctx, serversideMarker, tags)
 }
 
-// ExtractOutbound returns a pre-existing Tags object in the request's Context meant for server-side.
+// ExtractOutbound returns a pre-existing Tags object in the request's Context meant for client-side.
 // If the context wasn't set in the Middleware, a no-op Tag storage is returned that will *not* be propagated in context.
 func ExtractOutbound(req *http.Request) *Tags {
 	return ExtractOutboundFromCtx(req.Context())
@@ -78,7 +90,10 @@ func ExtractOutboundFromCtx(ctx context.Context) *Tags {
 	return t
 }
 
-func setOutboundInCtx(ctx context.Context, tags *Tags) context.Context {
+// SetOutboundInContext returns a copy of the Context with the given Tags, replacing the existing ones.
+//
+// This is meant for client-side Tripperware that make many requests out of one, e.g. to tag each of them separately.
+func SetOutboundInContext(ctx context.Context, tags *Tags) context.Context {
 	t, ok := ctx.Value(clientsideMarker).(*Tags)
 	if ok && t == tags { // points to same variable, no point setting.
 		return ctx
@@ -86,7 +101,8 @@ func setOutboundInCtx(ctx context.Context, tags *Tags) context.Context {
 	return context.WithValue(ctx, clientsideMarker, tags)
 }
 
-func setOutboundInRequest(req *http.Request, tags *Tags) *http.Request {
+// SetOutboundInRequest returns a copy of the request with the given Tags in its Context, see `SetOutboundInContext`.
+func SetOutboundInRequest(req *http.Request, tags *Tags) *http.Request {
 	t, ok := req.Context().Value(clientsideMarker).(*Tags)
 	if ok && t == tags { // points to same variable, no point setting.
 		return req
@@ -0,0 +1,41 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_ctxtags_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mwitkow/go-httpwares/tags"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInboundAndOutboundTagsAreSeparate(t *testing.T) {
+	var outbound *http_ctxtags.Tags
+	handler := http_ctxtags.Middleware("group")(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		outbound = http_ctxtags.ExtractOutbound(req).Set("some.outbound", true)
+		req = http_ctxtags.SetOutboundInRequest(req, outbound)
+		assert.False(t, http_ctxtags.ExtractInbound(req).Has("some.outbound"), "outbound tags must not leak into inbound")
+		assert.True(t, http_ctxtags.ExtractInbound(req).Has(http_ctxtags.TagForHandlerGroup), "inbound tags must be kept")
+		assert.Equal(t, outbound, http_ctxtags.ExtractOutbound(req), "outbound tags must be set in the request")
+	}))
+	req, _ := http.NewRequest("GET", "http://something.local/someurl", nil)
+	handler.ServeHTTP(nil, req)
+}
+
+func TestTagsCopyIsIndependent(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://something.local/someurl", nil)
+	original := http_ctxtags.ExtractOutbound(req).Set("a", 1)
+	copied := original.Copy().Set("b", 2)
+	assert.Equal(t, map[string]interface{}{"a": 1}, original.Values(), "the original must not be modified")
+	assert.Equal(t, map[string]interface{}{"a": 1, "b": 2}, copied.Values(), "the copy must have all values")
+}
+
+func TestServiceNameFallsBackToHost(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://something.local/someurl", nil)
+	assert.Equal(t, "something.local", http_ctxtags.ServiceName(req), "without tags the host must be used")
+	tags := http_ctxtags.ExtractOutbound(req).Set(http_ctxtags.TagForCallService, "backend")
+	req = http_ctxtags.SetOutboundInRequest(req, tags)
+	assert.Equal(t, "backend", http_ctxtags.ServiceName(req), "the service tag must take precedence")
+}
@@ -30,8 +30,19 @@ func Tripperware(opts ...Option) httpwares.Tripperware {
 				}
 			}
 
-			newReq := setOutboundInRequest(req, t)
+			newReq := SetOutboundInRequest(req, t)
 			return next.RoundTrip(newReq)
 		})
 	}
 }
+
+// ServiceName returns the name of the service the request is made to, as used by client-side wares keeping state per
+// service.
+//
+// This is the `http.call.service` tag set by `Tripperware`, or the host of the request URL if the tag is missing.
+func ServiceName(req *http.Request) string {
+	if svc, ok := ExtractOutbound(req).Values()[TagForCallService].(string); ok && svc != "" {
+		return svc
+	}
+	return req.URL.Host
+}
@@ -15,7 +15,6 @@ import (
 	"github.com/mwitkow/go-httpwares/tracing/opentracing"
 	"github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/mocktracer"
-	"github.com/pressly/chi"
 	"github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/net/context/ctxhttp"
 	_ "golang.org/x/net/trace" // import the debug pages
@@ -47,12 +46,12 @@ func main() {
 		logInstance.Printf("Google reached with err: %v", err)
 	}
 
-	chainedHandler := chi.Chain(
+	chainedHandler := httpwares.MiddlewareChain{
 		http_ctxtags.Middleware("google_ping_service"),
 		http_opentracing.Middleware(),
 		http_debug.Middleware(),
 		http_logrus.Middleware(logInstance),
-	).HandlerFunc(handlerFunc)
+	}.ForgeFunc(handlerFunc)
 
 	http.DefaultServeMux.Handle("/", chainedHandler)
 	http.DefaultServeMux.Handle("/metrics", prometheus.Handler())
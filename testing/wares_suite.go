@@ -16,7 +16,6 @@ import (
 
 	"github.com/mwitkow/go-conntrack/connhelpers"
 	"github.com/mwitkow/go-httpwares"
-	"github.com/pressly/chi"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"golang.org/x/net/context"
@@ -38,7 +37,7 @@ type WaresTestSuite struct {
 
 	ClientInLegacyHttp1Mode bool
 	ServerInLegacyHttp1Mode bool
-	ServerMiddleware        []httpwares.Middleware
+	ServerMiddleware        httpwares.MiddlewareChain
 	ClientTripperware       httpwares.TripperwareChain
 
 	Handler http.Handler
@@ -68,18 +67,10 @@ func (s *WaresTestSuite) SetupSuite() {
 		s.Handler = http.HandlerFunc(PingBackHandler(DefaultPingBackStatusCode))
 	}
 	if s.Server == nil {
-		handler := s.Handler
-		if len(s.ServerMiddleware) > 0 {
-			chains := [](func(http.Handler) http.Handler){}
-			for _, ware := range s.ServerMiddleware {
-				chains = append(chains, ware)
-			}
-			handler = chi.Chain(chains...).Handler(handler)
-		}
-		s.Server = &http.Server{
+		s.Server = s.ServerMiddleware.WrapServer(&http.Server{
 			ErrorLog: nil, // TODO(mwitkow): Add ErrorLog to testint.T.Log
-			Handler:  handler,
-		}
+			Handler:  s.Handler,
+		})
 	}
 
 	go func() {
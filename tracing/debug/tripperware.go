@@ -33,15 +33,15 @@ func Tripperware(opts ...Option) httpwares.Tripperware {
 			tr.LazyPrintf("invoking next chain")
 			resp, err := next.RoundTrip(req)
 			tr.LazyPrintf("tags: ")
-			for k, v := range http_ctxtags.ExtractInbound(req).Values() {
+			for k, v := range http_ctxtags.ExtractOutbound(req).Values() {
 				tr.LazyPrintf("%v: %v", k, v)
 			}
 			if err != nil {
 				tr.LazyPrintf("Error on response: %v", err)
 				tr.SetError()
 			} else {
-				tr.LazyPrintf("HTTP/%d.%d %d %s", resp.ProtoMajor, resp.ProtoMinor, resp.StatusCode, resp.StatusCode)
-				tr.LazyPrintf("Content-Length:  %d", resp.Status, resp.ContentLength)
+				tr.LazyPrintf("HTTP/%d.%d %s", resp.ProtoMajor, resp.ProtoMinor, resp.Status)
+				tr.LazyPrintf("Content-Length: %d", resp.ContentLength)
 				for k, _ := range resp.Header {
 					tr.LazyPrintf("%v: %v", k, resp.Header.Get(k))
 				}
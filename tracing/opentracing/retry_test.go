@@ -0,0 +1,52 @@
+// Copyright 2017 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package http_opentracing_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mwitkow/go-httpwares"
+	"github.com/mwitkow/go-httpwares/retry"
+	"github.com/mwitkow/go-httpwares/tags"
+	"github.com/mwitkow/go-httpwares/tracing/opentracing"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTripperwareCreatesSpanPerRetryAttempt(t *testing.T) {
+	mockTracer := mocktracer.New()
+	codes := []int{503, 200}
+	transport := httpwares.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		code := codes[0]
+		codes = codes[1:]
+		return &http.Response{StatusCode: code, Body: ioutil.NopCloser(strings.NewReader("")), Request: req}, nil
+	})
+	client := httpwares.TripperwareChain{
+		http_ctxtags.Tripperware(http_ctxtags.WithServiceName("flaky")),
+		http_retry.Tripperware(http_retry.WithBackoff(http_retry.BackoffLinear(0))),
+		http_opentracing.Tripperware(http_opentracing.WithTracer(mockTracer)),
+	}.WrapClient(&http.Client{Transport: transport})
+	parentSpan := mockTracer.StartSpan("parent")
+	parentCtx := parentSpan.Context().(mocktracer.MockSpanContext)
+	req, _ := http.NewRequest("GET", "http://something.local/someurl", nil)
+	req = req.WithContext(opentracing.ContextWithSpan(req.Context(), parentSpan))
+	resp, err := client.Do(req)
+	require.NoError(t, err, "call shouldn't fail")
+	resp.Body.Close()
+
+	spans := mockTracer.FinishedSpans()
+	require.Len(t, spans, 2, "each attempt must have its own span")
+	for i, span := range spans {
+		assert.EqualValues(t, i+1, span.Tag(http_retry.TagForRetryAttempt), "the span must be tagged with the attempt")
+		assert.Equal(t, "flaky", span.Tag(http_ctxtags.TagForCallService), "the span must be tagged with the service")
+		assert.Equal(t, parentCtx.SpanID, span.ParentID, "each attempt span must be a child of the caller's span")
+		assert.Equal(t, parentCtx.TraceID, span.SpanContext.TraceID, "each attempt span must be in the caller's trace")
+	}
+	assert.Equal(t, http_retry.RetryReasonDiscardedStatus, spans[1].Tag(http_retry.TagForRetryReason), "the retry reason must be tagged")
+}
@@ -17,6 +17,9 @@ import (
 )
 
 // Tripperware returns a piece of client-side Tripperware that forwards opentracing tokens.
+//
+// The client span is tagged with the outbound `http_ctxtags.Tags` of the request. When placed after
+// `http_retry.Tripperware`, every attempt gets its own client span.
 func Tripperware(opts ...Option) httpwares.Tripperware {
 	o := evaluateOptions(opts)
 	return func(next http.RoundTripper) http.RoundTripper {
@@ -26,6 +29,9 @@ func Tripperware(opts ...Option) httpwares.Tripperware {
 			}
 			newReq, clientSpan := newClientSpanFromRequest(req, o.tracer)
 			resp, err := next.RoundTrip(newReq)
+			for k, v := range http_ctxtags.ExtractOutbound(newReq).Values() {
+				clientSpan.SetTag(k, v)
+			}
 			if err != nil {
 				ext.Error.Set(clientSpan, true)
 				clientSpan.LogFields(otlog.String("event", "error"), otlog.String("message", err.Error()))